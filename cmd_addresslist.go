@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func addressListCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: addresslist add|remove|list [flags] [address]")
+	}
+
+	fs := newCommandFlags("addresslist " + args[0])
+	switch args[0] {
+	case "add":
+		kind := fs.String("kind", "deny", "list kind, allow or deny")
+		reason := fs.String("reason", "", "why the address is listed")
+		expiry := fs.Duration("expiry", 0, "how long the entry is valid, 0 means forever")
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 || !common.IsHexAddress(fs.Arg(0)) {
+			return errors.New("usage: addresslist add [-kind allow|deny] [-reason text] [-expiry 720h] <address>")
+		}
+
+		entry := &repository.AddressListEntry{Address: fs.Arg(0), Reason: *reason}
+		switch *kind {
+		case "allow":
+			entry.Kind = repository.AddressListAllow
+		case "deny":
+			entry.Kind = repository.AddressListDeny
+		default:
+			return fmt.Errorf("unknown list kind %q", *kind)
+		}
+		if *expiry > 0 {
+			entry.Expiry = sql.NullTime{Time: time.Now().Add(*expiry), Valid: true}
+		}
+
+		repo, closer, err := fs.repository()
+		if err != nil {
+			return err
+		}
+		defer closer()
+		audit := fs.audit("addresslist add", strings.ToLower(entry.Address), fmt.Sprintf("%s: %s", entry.Kind, entry.Reason))
+		return repo.SaveAddressListEntry(context.Background(), entry, audit)
+	case "remove":
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 || !common.IsHexAddress(fs.Arg(0)) {
+			return errors.New("usage: addresslist remove <address>")
+		}
+
+		repo, closer, err := fs.repository()
+		if err != nil {
+			return err
+		}
+		defer closer()
+		audit := fs.audit("addresslist remove", strings.ToLower(fs.Arg(0)), "")
+		return repo.DeleteAddressListEntry(context.Background(), fs.Arg(0), audit)
+	case "list":
+		_ = fs.Parse(args[1:])
+
+		repo, closer, err := fs.repository()
+		if err != nil {
+			return err
+		}
+		defer closer()
+		entries, err := repo.GetAddressListEntries(context.Background())
+		if err != nil {
+			return err
+		}
+
+		table := newTable()
+		fmt.Fprintln(table, "ADDRESS\tKIND\tEXPIRY\tREASON")
+		for _, item := range entries {
+			var expiry = "never"
+			if item.Expiry.Valid {
+				expiry = item.Expiry.Time.Format(time.RFC3339)
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", item.Address, item.Kind, expiry, strings.TrimSpace(item.Reason))
+		}
+		return table.Flush()
+	}
+	return fmt.Errorf("unknown addresslist action %q", args[0])
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+func depositsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("usage: deposits list [-status unprocessed|processing|done|ignore] [-to address] [-limit 50]")
+	}
+
+	fs := newCommandFlags("deposits list")
+	status := fs.String("status", "", "only list deposits with the status")
+	to := fs.String("to", "", "only list deposits to the address")
+	limit := fs.Int("limit", 50, "max rows to list")
+	_ = fs.Parse(args[1:])
+
+	var filter = repository.DepositFilter{To: *to, Limit: *limit}
+	if *status != "" {
+		value, err := repository.ParseDepositStatus(*status)
+		if err != nil {
+			return err
+		}
+		filter.Status = &value
+	}
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	deposits, err := repo.GetDeposits(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "ID\tHEIGHT\tTXID\tL2TOKEN\tFROM\tTO\tAMOUNT\tSTATUS\tCREATED")
+	for _, item := range deposits {
+		fmt.Fprintf(table, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Id, item.Height, item.Txid, item.L2Token,
+			item.From, item.To, item.Amount.ToInt(), item.Status, item.CreatedAt.Format(time.RFC3339))
+	}
+	return table.Flush()
+}
+
+func depositCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: deposit retry|ignore <id>")
+	}
+
+	var from, to repository.DepositStatus
+	switch args[0] {
+	case "retry":
+		from, to = repository.DepositStatusIgnore, repository.DepositStatusUnprocessed
+	case "ignore":
+		from, to = repository.DepositStatusUnprocessed, repository.DepositStatusIgnore
+	default:
+		return fmt.Errorf("unknown deposit action %q", args[0])
+	}
+
+	fs := newCommandFlags("deposit " + args[0])
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: deposit %s <id>", args[0])
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid deposit id: %s", err)
+	}
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	audit := fs.audit("deposit "+args[0], strconv.FormatUint(id, 10), fmt.Sprintf("%s -> %s", from, to))
+	return repo.ChangeDepositStatus(context.Background(), id, from, to, audit)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func dripCommand(args []string) error {
+	if len(args) == 0 || args[0] != "resend" {
+		return errors.New("usage: drip resend [-rpc endpoint] <txid>")
+	}
+
+	fs := newCommandFlags("drip resend")
+	endpoint := fs.String("rpc", "wss://andromeda-ws.metis.io", "rpc endpoint")
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return errors.New("usage: drip resend [-rpc endpoint] <txid>")
+	}
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	drip, err := repo.GetDrip(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var tx = new(types.Transaction)
+	if err := tx.UnmarshalBinary(drip.Rawtx); err != nil {
+		return fmt.Errorf("unable to decode drip tx: %s", err)
+	}
+
+	rpc, err := ethclient.DialContext(ctx, *endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to connect to rpc: %s", err)
+	}
+	defer rpc.Close()
+
+	// the audit log records the outcome, a failed resend is audited as failed
+	sendErr := rpc.SendTransaction(ctx, tx)
+	var detail = drip.To
+	if sendErr != nil {
+		detail = fmt.Sprintf("%s failed: %s", drip.To, sendErr)
+	}
+	if err := repo.AddAuditLog(ctx, fs.audit("drip resend", drip.Txid, detail)); err != nil {
+		return err
+	}
+	return sendErr
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// heightCommand moves the sync cursor. The syncer keeps its height in memory and overwrites the cursor
+// on its next save, so the syncer of the chain must be stopped before and restarted after.
+func heightCommand(args []string) error {
+	if len(args) == 0 || args[0] != "set" {
+		return errors.New("usage: height set <number>, with the syncer of the chain stopped")
+	}
+
+	fs := newCommandFlags("height set")
+	_ = fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		return errors.New("usage: height set <number>, with the syncer of the chain stopped")
+	}
+	number, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid height: %s", err)
+	}
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	audit := fs.audit("height set", "height", fmt.Sprintf("sync resumes from %d", number+1))
+	return repo.SetHeight(context.Background(), number, audit)
+}
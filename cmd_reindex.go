@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/services"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func reindexCommand(args []string) error {
+	fs := newCommandFlags("reindex")
+	endpoint := fs.String("rpc", "wss://andromeda-ws.metis.io", "rpc endpoint")
+	from := fs.Uint64("from", 0, "first block to reindex")
+	to := fs.Uint64("to", 0, "last block to reindex")
+	rangeSync := fs.Uint64("range", 1000, "range sync at once")
+	_ = fs.Parse(args)
+	if *to == 0 || *from > *to {
+		return errors.New("usage: reindex -from <height> -to <height> [-range 1000] [-rpc endpoint]")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	rpc, err := ethclient.DialContext(ctx, *endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to connect to rpc: %s", err)
+	}
+	defer rpc.Close()
+
+	chainId, err := rpc.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get chain id: %s", err)
+	}
+	network, err := utils.GetNetwork(chainId.Uint64())
+	if err != nil {
+		return err
+	}
+
+	bridge, err := metisl2.NewL2StandardBridge(common.HexToAddress(network.BridgeAddress), rpc)
+	if err != nil {
+		return fmt.Errorf("unable to create bridge instance: %s", err)
+	}
+
+	// the deposits are scoped by the chain of the rpc rather than the -chain flag
+	*fs.chainId = network.ChainId
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	syncer := &services.DataSync{
+		Network:    network,
+		Web3Client: rpc,
+		Repositroy: repo,
+		Bridge:     bridge,
+		RangeSync:  *rangeSync,
+	}
+	audit := fs.audit("reindex", "deposits", fmt.Sprintf("from %d to %d", *from, *to))
+	if err := repo.AddAuditLog(ctx, audit); err != nil {
+		return err
+	}
+	return syncer.Reindex(ctx, *from, *to)
+}
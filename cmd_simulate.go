@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/services"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/sirupsen/logrus"
+)
+
+// simInput is a line of a jsonl export of deposits, decimals is 18 and standard is true if omitted,
+// tokenL1 is the L1 token of the L2 token and the l1token of the deposit is trusted if omitted,
+// drippedAt is the time of the actual drip and the time of the deposit is used if omitted
+type simInput struct {
+	Id        uint64     `json:"id"`
+	Height    uint64     `json:"height"`
+	L1Token   string     `json:"l1token"`
+	L2Token   string     `json:"l2token"`
+	From      string     `json:"from"`
+	To        string     `json:"to"`
+	Amount    bigint.Int `json:"amount"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Decimals  *uint8     `json:"decimals"`
+	Standard  *bool      `json:"standard"`
+	TokenL1   string     `json:"tokenL1"`
+	Dripped   float64    `json:"dripped"`
+	DrippedAt time.Time  `json:"drippedAt"`
+}
+
+func simulateCommand(args []string) error {
+	fs := newCommandFlags("simulate")
+	input := fs.String("input", "", "jsonl export of the deposits to replay, empty means the deposits in mysql")
+	fromId := fs.Uint64("from-id", 0, "replay the deposits in mysql after the id")
+	limit := fs.Int("limit", 10000, "max deposits in mysql to replay")
+	statePath := fs.String("state", "", "json file of the token prices and the receiver states, receivers not in it are fresh EOAs")
+	priceSubgraph := fs.String("price-subgraph", "", "subgraph pricing the tokens without a price in -state at their current price, the one of the chain by default")
+	lists := fs.Bool("lists", true, "use the address lists in mysql besides -allow and -deny")
+
+	var config services.SimConfig
+	var allow, deny listValue
+	var tiers string
+	fs.Uint64Var(&config.DripHeight, "height", 100, "height to transfer a drip")
+	fs.Float64Var(&config.MinUSD, "minusd", 500, "min usd value")
+	fs.Float64Var(&config.DripAmount, "drip", 0.01, "metis amount to transfer")
+	fs.StringVar(&tiers, "tiers", "", "comma separated minusd:drip tiers, a deposit gets the drip of the highest tier it reaches")
+	fs.Var(&allow, "allow", "comma separated addresses to allowlist")
+	fs.Var(&deny, "deny", "comma separated addresses to denylist")
+	fs.IntVar(&config.FromLimit, "from-limit", 0, "max drips per L1 sender within the from window, 0 means no limit")
+	fs.DurationVar(&config.FromWindow, "from-window", time.Hour*24, "time window of the from limit")
+	_ = fs.Parse(args)
+
+	var err error
+	if config.Tiers, err = parseTiers(tiers); err != nil {
+		return err
+	}
+	config.Allow, config.Deny = addressSet(allow), addressSet(deny)
+
+	network, err := utils.GetNetwork(*fs.chainId)
+	if err != nil {
+		return err
+	}
+	config.Network = network
+	if *priceSubgraph == "" {
+		*priceSubgraph = network.PriceSubgraph
+	}
+	if *priceSubgraph != "" {
+		config.Prices = utils.NewUniswapWithEndpoint(*priceSubgraph)
+	} else {
+		logrus.Warnf("No price subgraph for chain %d, the deposits of the tokens without a price in -state are skipped", network.ChainId)
+	}
+
+	var state services.SimState
+	if *statePath != "" {
+		if state, err = loadSimState(*statePath); err != nil {
+			return err
+		}
+	}
+
+	var deposits []*services.SimDeposit
+	if *input != "" {
+		if deposits, err = loadSimInput(*input); err != nil {
+			return err
+		}
+	} else {
+		repo, closer, err := fs.repository()
+		if err != nil {
+			return err
+		}
+		defer closer()
+		if deposits, err = loadSimDeposits(context.Background(), repo, *fromId, *limit); err != nil {
+			return err
+		}
+		if err := loadSimDripped(context.Background(), repo, *fromId, &state); err != nil {
+			return err
+		}
+		if *lists {
+			if err := loadSimLists(context.Background(), repo, &config); err != nil {
+				return err
+			}
+		}
+	}
+
+	report, err := services.Simulate(context.Background(), config, state, deposits)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintf(table, "deposits\t%d\t\n", report.Deposits)
+	fmt.Fprintln(table, "\tSIMULATED\tACTUAL")
+	fmt.Fprintf(table, "drips\t%d\t%d\n", report.Drips, report.ActualDrips)
+	fmt.Fprintf(table, "metis\t%f\t%f\n", report.Metis, report.ActualMetis)
+	fmt.Fprintf(table, "gained drips\t%d\t\n", report.Gained)
+	fmt.Fprintf(table, "lost drips\t%d\t\n", report.Lost)
+	for _, item := range report.SkippedReasons() {
+		fmt.Fprintf(table, "skipped %s\t%d\t\n", item.Reason, item.Count)
+	}
+	return table.Flush()
+}
+
+func parseTiers(s string) ([]services.SimTier, error) {
+	var tiers []services.SimTier
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("tier %q should be minusd:drip", item)
+		}
+		minUSD, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q: %s", item, err)
+		}
+		drip, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q: %s", item, err)
+		}
+		tiers = append(tiers, services.SimTier{MinUSD: minUSD, Drip: drip})
+	}
+	return tiers, nil
+}
+
+func addressSet(addresses []string) map[string]bool {
+	var set = make(map[string]bool)
+	for _, item := range addresses {
+		set[strings.ToLower(item)] = true
+	}
+	return set
+}
+
+func loadSimState(path string) (services.SimState, error) {
+	var raw services.SimState
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return raw, err
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return raw, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	var state = services.SimState{Prices: make(map[string]float64), Accounts: make(map[string]services.SimAccount)}
+	for token, price := range raw.Prices {
+		state.Prices[strings.ToLower(token)] = price
+	}
+	for address, account := range raw.Accounts {
+		state.Accounts[strings.ToLower(address)] = account
+	}
+	if len(raw.Dripped) > 0 {
+		state.Dripped = make(map[string]bool)
+	}
+	for address, dripped := range raw.Dripped {
+		state.Dripped[strings.ToLower(address)] = dripped
+	}
+	return state, nil
+}
+
+func loadSimInput(path string) ([]*services.SimDeposit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var deposits []*services.SimDeposit
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var item simInput
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		deposit := &services.SimDeposit{
+			Deposit: &repository.Deposit{
+				Id:        item.Id,
+				Height:    item.Height,
+				L1Token:   item.L1Token,
+				L2Token:   item.L2Token,
+				From:      item.From,
+				To:        item.To,
+				Amount:    item.Amount,
+				CreatedAt: item.CreatedAt,
+			},
+			Decimals:  18,
+			Standard:  true,
+			TokenL1:   item.TokenL1,
+			Dripped:   item.Dripped,
+			DrippedAt: item.DrippedAt,
+		}
+		if item.Decimals != nil {
+			deposit.Decimals = *item.Decimals
+		}
+		if item.Standard != nil {
+			deposit.Standard = *item.Standard
+		}
+		deposits = append(deposits, deposit)
+	}
+	return deposits, scanner.Err()
+}
+
+// loadSimDeposits reads the deposits after the id with the metadata of their tokens and their actual drips
+func loadSimDeposits(ctx context.Context, repo repository.Metis, fromId uint64, limit int) ([]*services.SimDeposit, error) {
+	var deposits []*services.SimDeposit
+	var tokens = make(map[string]*repository.Token)
+	for cursor := fromId; len(deposits) < limit; {
+		var size = limit - len(deposits)
+		if size > 500 {
+			size = 500
+		}
+		page, err := repo.GetDepositsAfter(ctx, cursor, size)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		var pids = make([]uint64, 0, len(page))
+		for _, item := range page {
+			pids = append(pids, item.Id)
+		}
+		drips, err := repo.GetDripsOf(ctx, pids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page {
+			token, ok := tokens[item.L2Token]
+			if !ok {
+				if token, err = repo.GetToken(ctx, item.L2Token); err != nil {
+					return nil, err
+				}
+				if token == nil {
+					logrus.Warnf("Token %s is not saved, taking it as a standard token of 18 decimals", item.L2Token)
+					token = &repository.Token{Address: item.L2Token, L1Token: item.L1Token, Decimals: 18, Standard: true}
+				}
+				tokens[item.L2Token] = token
+			}
+			deposit := &services.SimDeposit{
+				Deposit:  item,
+				Decimals: token.Decimals,
+				Standard: token.Standard,
+				TokenL1:  token.L1Token,
+			}
+			if drip, ok := drips[item.Id]; ok {
+				deposit.Dripped, deposit.DrippedAt = drip.Amount, drip.CreatedAt
+			}
+			deposits = append(deposits, deposit)
+		}
+		cursor = page[len(page)-1].Id
+	}
+	return deposits, nil
+}
+
+// loadSimDripped adds the receivers of the drips of the deposits up to the id to the state,
+// they are not dripped again like in the faucet
+func loadSimDripped(ctx context.Context, repo repository.Metis, fromId uint64, state *services.SimState) error {
+	receivers, err := repo.GetDripReceivers(ctx, fromId)
+	if err != nil {
+		return err
+	}
+	if state.Dripped == nil {
+		state.Dripped = make(map[string]bool)
+	}
+	for _, item := range receivers {
+		state.Dripped[strings.ToLower(item)] = true
+	}
+	return nil
+}
+
+// loadSimLists adds the unexpired entries of the address lists to the config
+func loadSimLists(ctx context.Context, repo repository.Metis, config *services.SimConfig) error {
+	entries, err := repo.GetAddressListEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range entries {
+		if item.Expiry.Valid && item.Expiry.Time.Before(time.Now()) {
+			continue
+		}
+		switch item.Kind {
+		case repository.AddressListAllow:
+			config.Allow[strings.ToLower(item.Address)] = true
+		case repository.AddressListDeny:
+			config.Deny[strings.ToLower(item.Address)] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+func statsCommand(args []string) error {
+	fs := newCommandFlags("stats")
+	_ = fs.Parse(args)
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	stats, err := repo.GetStats(context.Background())
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintf(table, "height\t%d\n", stats.Height)
+	for _, status := range []repository.DepositStatus{
+		repository.DepositStatusUnprocessed,
+		repository.DepositStatusProcessing,
+		repository.DepositStatusDone,
+		repository.DepositStatusIgnore,
+	} {
+		fmt.Fprintf(table, "deposits %s\t%d\n", status, stats.Deposits[status])
+	}
+	fmt.Fprintf(table, "drips\t%d\n", stats.Drips)
+	fmt.Fprintf(table, "drips amount\t%f\n", stats.DripsAmount)
+	return table.Flush()
+}
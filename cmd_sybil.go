@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func sybilCommand(args []string) error {
+	if len(args) == 0 || args[0] != "report" {
+		return errors.New("usage: sybil report [-since 720h] [-min 5] [-limit 50]")
+	}
+
+	fs := newCommandFlags("sybil report")
+	since := fs.Duration("since", time.Hour*24*30, "only count deposits within the duration")
+	min := fs.Int("min", 5, "min distinct recipients of an L1 sender")
+	limit := fs.Int("limit", 50, "max rows to report")
+	_ = fs.Parse(args[1:])
+
+	repo, closer, err := fs.repository()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	clusters, err := repo.GetFundingClusters(context.Background(), *since, *min, *limit)
+	if err != nil {
+		return err
+	}
+
+	table := newTable()
+	fmt.Fprintln(table, "FROM\tRECIPIENTS\tDRIPS\tFIRST SEEN\tLAST SEEN")
+	for _, item := range clusters {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%s\t%s\n", item.From, item.Recipients, item.Drips,
+			item.FirstSeen.Format(time.RFC3339), item.LastSeen.Format(time.RFC3339))
+	}
+	return table.Flush()
+}
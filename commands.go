@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"text/tabwriter"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultMysqlEndpoint = "root:Pa$$w0rd@tcp(127.0.0.1:3306)/metis?parseTime=true"
+
+// commands are the operator subcommands, run as `metis-bridge-faucet <command> <action> [flags] [args]`
+var commands = map[string]func(args []string) error{
+	"addresslist": addressListCommand,
+	"sybil":       sybilCommand,
+	"deposits":    depositsCommand,
+	"deposit":     depositCommand,
+	"drip":        dripCommand,
+	"height":      heightCommand,
+	"stats":       statsCommand,
+	"reindex":     reindexCommand,
+	"simulate":    simulateCommand,
+}
+
+type commandFlags struct {
+	*flag.FlagSet
+	mysql    *string
+	operator *string
+	chainId  *uint64
+}
+
+func newCommandFlags(name string) *commandFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &commandFlags{
+		FlagSet:  fs,
+		mysql:    fs.String("mysql", defaultMysqlEndpoint, "mysql endpoint"),
+		operator: fs.String("operator", currentUser(), "operator name recorded in the audit log"),
+		chainId:  fs.Uint64("chain", utils.AndromedaChainId, "chain id of the deposits and drips"),
+	}
+}
+
+func (fs *commandFlags) repository() (repository.Metis, func(), error) {
+	mysql, err := repository.Connect(*fs.mysql)
+	if err != nil {
+		return repository.Metis{}, nil, fmt.Errorf("unable to connect to mysql: %s", err)
+	}
+	return repository.NewMetis(mysql, *fs.chainId), func() { mysql.Close() }, nil
+}
+
+// audit creates the audit log of an operator action and logs it
+func (fs *commandFlags) audit(action, target, detail string) *repository.AuditLog {
+	logrus.Infof("%s: %s %s %s", *fs.operator, action, target, detail)
+	return &repository.AuditLog{Operator: *fs.operator, Action: action, Target: target, Detail: detail}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
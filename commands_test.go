@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// the arguments are validated before connecting to mysql
+func TestCommands_Usage(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		want    string
+	}{
+		{"deposits", nil, "usage: deposits list"},
+		{"deposits", []string{"list", "-status", "lost"}, `unknown deposit status "lost"`},
+		{"deposit", nil, "usage: deposit retry|ignore"},
+		{"deposit", []string{"drop", "1"}, `unknown deposit action "drop"`},
+		{"deposit", []string{"retry"}, "usage: deposit retry <id>"},
+		{"deposit", []string{"ignore", "0x1"}, "invalid deposit id"},
+		{"drip", []string{"cancel"}, "usage: drip resend"},
+		{"drip", []string{"resend"}, "usage: drip resend"},
+		{"height", []string{"set"}, "usage: height set"},
+		{"height", []string{"set", "tip"}, "invalid height"},
+		{"sybil", []string{"list"}, "usage: sybil report"},
+	}
+	for _, tt := range tests {
+		err := commands[tt.command](tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %v = %v, want %q", tt.command, tt.args, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+)
+
+// chainConfig configures the pipeline of a chain.
+// The flags fill the defaults, which are overridden per chain by the -chains file.
+type chainConfig struct {
+	ChainId        uint64   `json:"chainId"`
+	Rpc            []string `json:"rpc"`
+	RpcSend        []string `json:"rpcSend"`
+	RpcHedge       duration `json:"rpcHedge"`
+	RpcMaxLag      uint64   `json:"rpcMaxLag"`
+	RpcMaxStale    duration `json:"rpcMaxStale"`
+	Subscribe      bool     `json:"subscribe"`
+	RangeSync      uint64   `json:"range"`
+	MaxRangeSync   uint64   `json:"rangeMax"`
+	CatchUpRange   uint64   `json:"catchupRange"`
+	CatchUpWorkers int      `json:"catchupWorkers"`
+	DripHeight     uint64   `json:"height"`
+
+	// the fields of the network profile of the chain, empty means the built-in profile
+	Bridge        string   `json:"bridge"`
+	MetisToken    string   `json:"metisToken"`
+	StableTokens  []string `json:"stableTokens"`
+	PriceSubgraph string   `json:"priceSubgraph"`
+
+	OpenFaucet      bool     `json:"faucet"`
+	FaucetWorker    bool     `json:"faucetWorker"`
+	DryRun          bool     `json:"dryRun"`
+	DryRunFrom      uint64   `json:"dryRunFrom"`
+	CheckWorkers    int      `json:"checkWorkers"`
+	CheckAtDeposit  bool     `json:"checkAtDepositHeight"`
+	Keys            []string `json:"keys"`
+	MinUSD          float64  `json:"minusd"`
+	DripAmount      float64  `json:"drip"`
+	FromLimit       int      `json:"fromLimit"`
+	FromWindow      duration `json:"fromWindow"`
+	MaxDripsPerHour int      `json:"maxDripsHour"`
+	MaxMetisPerDay  float64  `json:"maxMetisDay"`
+	LowBalance      float64  `json:"lowBalance"`
+	TreasuryKey     string   `json:"treasuryKey"`
+	RefillBelow     float64  `json:"refillBelow"`
+	RefillAmount    float64  `json:"refillAmount"`
+
+	WebhookURL         string `json:"webhookUrl"`
+	WebhookSecret      string `json:"webhookSecret"`
+	WebhookMaxAttempts int    `json:"webhookMaxAttempts"`
+
+	ReadySyncDelay      duration `json:"readySyncDelay"`
+	ReadyFaucetFailures int      `json:"readyFaucetFailures"`
+}
+
+func (c *chainConfig) registerFlags(fs *flag.FlagSet) {
+	fs.Uint64Var(&c.ChainId, "chain", 0, "chain id, 0 means the chain id of the rpc")
+	c.Rpc = []string{"wss://andromeda-ws.metis.io"}
+	fs.Var((*listValue)(&c.Rpc), "rpc", "comma separated rpc endpoints, in the order of preference")
+	fs.Var((*listValue)(&c.RpcSend), "rpc-send", "comma separated rpc endpoints to send transactions, empty means the rpc endpoints")
+	fs.DurationVar((*time.Duration)(&c.RpcHedge), "rpc-hedge", 0, "start a read on the next rpc endpoint if there is no result after it, 0 means disabled")
+	fs.Uint64Var(&c.RpcMaxLag, "rpc-max-lag", 10, "max blocks a healthy rpc endpoint can fall behind the others")
+	fs.DurationVar((*time.Duration)(&c.RpcMaxStale), "rpc-max-stale", time.Minute*10, "max age of the head block of a healthy rpc endpoint, 0 means unchecked")
+	fs.BoolVar(&c.Subscribe, "subscribe", false, "sync with websocket subscriptions instead of polling")
+	fs.Uint64Var(&c.RangeSync, "range", 20, "initial range sync at once, it adapts to the rpc")
+	fs.Uint64Var(&c.MaxRangeSync, "range-max", 5000, "max range sync at once")
+	fs.Uint64Var(&c.CatchUpRange, "catchup-range", 50000, "range sync at once when catching up")
+	fs.IntVar(&c.CatchUpWorkers, "catchup-workers", 4, "concurrent range fetches when catching up, less than 2 means disabled")
+	fs.Uint64Var(&c.DripHeight, "height", 100, "height to transfer a drip")
+
+	fs.StringVar(&c.Bridge, "bridge", "", "address of the L2 standard bridge, empty means the one of the chain profile")
+	fs.StringVar(&c.MetisToken, "metis-token", "", "address of the L2 metis token, empty means the one of the chain profile")
+	fs.Var((*listValue)(&c.StableTokens), "stable-tokens", "comma separated L2 tokens worth 1 usd, empty means the ones of the chain profile")
+	fs.StringVar(&c.PriceSubgraph, "price-subgraph", "", "uniswap v2 subgraph pricing the L1 tokens, empty means the one of the chain profile")
+
+	fs.BoolVar(&c.OpenFaucet, "faucet", false, "faucet")
+	fs.BoolVar(&c.FaucetWorker, "faucet-worker", false, "run the faucet as one of several workers claiming deposits without the faucet leader election, each worker needs its own key")
+	fs.BoolVar(&c.DryRun, "dry-run", false, "run a faucet which evaluates the deposits and signs the drips into the shadow_drips table without broadcasting them or changing the deposits, it can't be used with -faucet")
+	fs.Uint64Var(&c.DryRunFrom, "dry-run-from", 0, "deposit id the first dry run starts after, 0 means the last deposit, later runs resume from the shadow drips")
+	fs.IntVar(&c.CheckWorkers, "check-workers", 4, "deposits of a batch checked concurrently before the drips are signed in order")
+	fs.BoolVar(&c.CheckAtDeposit, "check-at-deposit-height", false, "check the balance, the code and the nonce of the receiver at the deposit block, it needs an archive node, head is used otherwise")
+	c.Keys = []string{"key.txt"}
+	fs.Var((*listValue)(&c.Keys), "key", "comma separated private key paths of the faucet wallets, each drip is sent from the healthiest one")
+	fs.Float64Var(&c.MinUSD, "minusd", 500, "min usd value")
+	fs.Float64Var(&c.DripAmount, "drip", 0.01, "metis amount to transfer")
+	fs.IntVar(&c.FromLimit, "from-limit", 0, "max drips per L1 sender within the from window, 0 means no limit")
+	fs.DurationVar((*time.Duration)(&c.FromWindow), "from-window", time.Hour*24, "time window of the from limit")
+	fs.IntVar(&c.MaxDripsPerHour, "max-drips-hour", 0, "max drips per hour, 0 means no limit")
+	fs.Float64Var(&c.MaxMetisPerDay, "max-metis-day", 0, "max metis amount to transfer per day, 0 means no limit")
+	fs.Float64Var(&c.LowBalance, "low-balance", 0, "metis balance of a faucet wallet to emit the wallet.low event, 0 means disabled")
+	fs.StringVar(&c.TreasuryKey, "treasury-key", "", "private key path of the treasury refilling the faucet wallets, empty means disabled. Faucet workers can't have one")
+	fs.Float64Var(&c.RefillBelow, "refill-below", 1, "metis balance of a faucet wallet to refill it from the treasury")
+	fs.Float64Var(&c.RefillAmount, "refill-amount", 10, "metis amount to refill a faucet wallet")
+
+	fs.StringVar(&c.WebhookURL, "webhook-url", "", "url to post the webhook events, empty means disabled")
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", "", "secret to sign the webhook events with HMAC-SHA256, required with a webhook url")
+	fs.IntVar(&c.WebhookMaxAttempts, "webhook-max-attempts", 10, "attempts to deliver a webhook event before giving it up, 0 means no limit")
+
+	fs.DurationVar((*time.Duration)(&c.ReadySyncDelay), "ready-sync-delay", time.Minute*5, "not ready if the syncer has not advanced within it while holding the sync lease, 0 means unchecked")
+	fs.IntVar(&c.ReadyFaucetFailures, "ready-faucet-failures", 5, "not ready if the faucet has failed that many cycles in a row, 0 means unchecked")
+}
+
+func (c *chainConfig) normalize() error {
+	if len(c.Rpc) == 0 {
+		return fmt.Errorf("chain %d: no rpc endpoint", c.ChainId)
+	}
+	if c.RangeSync == 0 {
+		c.RangeSync = 20
+	}
+	if c.DripAmount <= 0 {
+		c.DripAmount = 0.01
+	}
+	// the dry run is a faucet of its own, which runs beside the faucet in another process
+	if c.OpenFaucet && c.DryRun {
+		return fmt.Errorf("chain %d: a dry run can't broadcast the drips, run it without the faucet", c.ChainId)
+	}
+	if (c.OpenFaucet || c.DryRun) && len(c.Keys) == 0 {
+		return fmt.Errorf("chain %d: no faucet key", c.ChainId)
+	}
+	// the workers would refill the same wallets and race on the nonce of the treasury
+	if c.TreasuryKey != "" && c.FaucetWorker {
+		return fmt.Errorf("chain %d: a treasury can't refill faucet workers", c.ChainId)
+	}
+	if c.TreasuryKey != "" && (c.RefillBelow <= 0 || c.RefillAmount <= 0) {
+		return fmt.Errorf("chain %d: refill below and refill amount should be positive with a treasury", c.ChainId)
+	}
+	if c.WebhookURL != "" && c.WebhookSecret == "" {
+		return fmt.Errorf("chain %d: no webhook secret to sign the events", c.ChainId)
+	}
+	return nil
+}
+
+// network returns the built-in profile of the chain with the fields set by the config,
+// it fails if the profile misses a field the pipeline needs
+func (c *chainConfig) network() (*utils.Network, error) {
+	network, err := utils.GetNetwork(c.ChainId)
+	if err != nil {
+		return nil, err
+	}
+	network = network.Override(utils.Network{
+		BridgeAddress:  c.Bridge,
+		MetisL2Address: c.MetisToken,
+		StableL2Tokens: c.StableTokens,
+		PriceSubgraph:  c.PriceSubgraph,
+	})
+	// only the faucet prices the deposits
+	if err := network.Validate(c.OpenFaucet || c.DryRun); err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// loadChainConfigs reads a json array of chain configs, each of them starts from the defaults
+func loadChainConfigs(path string, defaults chainConfig) ([]chainConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+
+	var configs []chainConfig
+	var seen = make(map[uint64]bool)
+	for _, raw := range raws {
+		config := defaults
+		config.Rpc, config.RpcSend = nil, nil
+		// json reuses the backing array of a slice, the lists of the defaults must not be overwritten
+		config.Keys = append([]string(nil), defaults.Keys...)
+		config.StableTokens = append([]string(nil), defaults.StableTokens...)
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+		}
+		if err := config.legacyKey(raw); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if config.ChainId == 0 || seen[config.ChainId] {
+			return nil, fmt.Errorf("%s: every chain needs a distinct chainId", path)
+		}
+		seen[config.ChainId] = true
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// legacyKey reads the single "key" of the chains files written before the wallet pool
+func (c *chainConfig) legacyKey(raw json.RawMessage) error {
+	var legacy struct {
+		Key  *string   `json:"key"`
+		Keys *[]string `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &legacy); err != nil {
+		return err
+	}
+	if legacy.Key == nil {
+		return nil
+	}
+	if legacy.Keys != nil {
+		return fmt.Errorf("chain %d: key and keys are both set", c.ChainId)
+	}
+	c.Keys = []string{*legacy.Key}
+	return nil
+}
+
+// duration is a time.Duration written as "30s" in json
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// listValue is a comma separated flag value
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(s string) error {
+	*l = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadChainConfigs(t *testing.T) {
+	var defaults chainConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defaults.registerFlags(fs)
+	if err := fs.Parse([]string{"-rpc", "wss://andromeda-ws.metis.io", "-minusd", "100"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "chains.json")
+	data := `[
+		{"chainId": 1088, "rpc": ["wss://a.example", "wss://b.example"], "faucet": true, "fromWindow": "1h"},
+		{"chainId": 588, "rpc": ["wss://stardust-ws.metis.io"], "minusd": 1}
+	]`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := loadChainConfigs(path, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("loadChainConfigs() returns %d configs, want 2", len(configs))
+	}
+
+	andromeda, stardust := configs[0], configs[1]
+	if !reflect.DeepEqual(andromeda.Rpc, []string{"wss://a.example", "wss://b.example"}) {
+		t.Errorf("andromeda rpc = %v", andromeda.Rpc)
+	}
+	if !andromeda.OpenFaucet || andromeda.MinUSD != 100 || time.Duration(andromeda.FromWindow) != time.Hour {
+		t.Errorf("andromeda should override the defaults, got %+v", andromeda)
+	}
+	if stardust.OpenFaucet || stardust.MinUSD != 1 || time.Duration(stardust.FromWindow) != time.Hour*24 {
+		t.Errorf("stardust should keep the defaults, got %+v", stardust)
+	}
+}
+
+func TestLoadChainConfigs_DuplicateChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chains.json")
+	data := `[{"chainId": 1088, "rpc": ["wss://a.example"]}, {"chainId": 1088, "rpc": ["wss://b.example"]}]`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadChainConfigs(path, chainConfig{}); err == nil {
+		t.Errorf("loadChainConfigs() should reject duplicate chains")
+	}
+}
+
+func TestChainConfig_NormalizeWebhook(t *testing.T) {
+	config := chainConfig{ChainId: 1088, Rpc: []string{"wss://a.example"}, WebhookURL: "https://hooks.example"}
+	if err := config.normalize(); err == nil {
+		t.Errorf("normalize() should reject a webhook url without a secret")
+	}
+	config.WebhookSecret = "secret"
+	if err := config.normalize(); err != nil {
+		t.Errorf("normalize() = %v", err)
+	}
+}
+
+func TestLoadChainConfigs_LegacyKey(t *testing.T) {
+	defaults := chainConfig{Keys: []string{"key.txt"}}
+	path := filepath.Join(t.TempDir(), "chains.json")
+	data := `[{"chainId": 1088, "key": "andromeda.txt"}, {"chainId": 588, "keys": ["a.txt", "b.txt"]}, {"chainId": 599}]`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := loadChainConfigs(path, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]string{{"andromeda.txt"}, {"a.txt", "b.txt"}, {"key.txt"}} {
+		if !reflect.DeepEqual(configs[i].Keys, want) {
+			t.Errorf("chain %d keys = %v, want %v", configs[i].ChainId, configs[i].Keys, want)
+		}
+	}
+
+	data = `[{"chainId": 1088, "key": "a.txt", "keys": ["b.txt"]}]`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadChainConfigs(path, defaults); err == nil {
+		t.Error("loadChainConfigs() should reject both key and keys")
+	}
+}
+
+func TestChainConfig_NormalizeTreasury(t *testing.T) {
+	config := chainConfig{ChainId: 1088, Rpc: []string{"wss://a.example"}, TreasuryKey: "treasury.txt", RefillBelow: 1, RefillAmount: 10}
+	if err := config.normalize(); err != nil {
+		t.Errorf("normalize() = %v", err)
+	}
+	config.FaucetWorker = true
+	if err := config.normalize(); err == nil {
+		t.Error("normalize() should reject a treasury of faucet workers")
+	}
+}
+
+func TestChainConfig_NormalizeDryRun(t *testing.T) {
+	config := chainConfig{ChainId: 1088, Rpc: []string{"wss://a.example"}, Keys: []string{"key.txt"}, DryRun: true}
+	if err := config.normalize(); err != nil {
+		t.Errorf("normalize() = %v", err)
+	}
+	config.OpenFaucet = true
+	if err := config.normalize(); err == nil {
+		t.Error("normalize() should reject a dry run with the faucet")
+	}
+	config.OpenFaucet, config.Keys = false, nil
+	if err := config.normalize(); err == nil {
+		t.Error("normalize() should reject a dry run without a key")
+	}
+}
+
+func TestChainConfig_Network(t *testing.T) {
+	var defaults chainConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defaults.registerFlags(fs)
+	if err := fs.Parse([]string{"-stable-tokens", "0x0000000000000000000000000000000000000001"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "chains.json")
+	data := `[
+		{"chainId": 1088, "faucet": true},
+		{"chainId": 588, "faucet": true, "stableTokens": ["0x0000000000000000000000000000000000000002"], "priceSubgraph": "https://subgraph.example"},
+		{"chainId": 599, "faucet": true}
+	]`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := loadChainConfigs(path, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	andromeda, err := configs[0].network()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(andromeda.StableL2Tokens, []string{"0x0000000000000000000000000000000000000001"}) {
+		t.Errorf("andromeda stable tokens = %v, want the default", andromeda.StableL2Tokens)
+	}
+	stardust, err := configs[1].network()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stardust.StableL2Tokens, []string{"0x0000000000000000000000000000000000000002"}) || stardust.PriceSubgraph != "https://subgraph.example" {
+		t.Errorf("stardust should override the profile, got %+v", stardust)
+	}
+	if _, err := configs[2].network(); err == nil {
+		t.Error("network() should reject a chain without a profile")
+	}
+
+	configs[1].PriceSubgraph = ""
+	if _, err := configs[1].network(); err == nil {
+		t.Error("network() should reject a faucet without a price source")
+	}
+	configs[1].OpenFaucet = false
+	if _, err := configs[1].network(); err != nil {
+		t.Errorf("network() of a syncer without a price source = %v", err)
+	}
+}
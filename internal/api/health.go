@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+type chainIdReader interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type syncer interface {
+	LastSynced() time.Time
+}
+
+type leader interface {
+	Leading() bool
+}
+
+// Readiness configures the readiness checks of a chain
+type Readiness struct {
+	ChainId    uint64
+	Web3Client chainIdReader
+	DB         pinger
+	Syncer     syncer
+	// SyncLeader is nil if leader election is disabled, a standby replica doesn't sync so its syncer is unchecked
+	SyncLeader leader
+
+	// MaxSyncDelay is how long the syncer can go without advancing, 0 means unchecked
+	MaxSyncDelay time.Duration
+	// MaxFaucetFailures is how many faucet cycles can fail in a row, 0 means unchecked
+	MaxFaucetFailures int
+}
+
+// problems returns why the chain is not ready, empty if it's ready
+func (c *Chain) problems(ctx context.Context) []string {
+	var problems []string
+	var check = c.Readiness
+
+	if check.DB != nil {
+		if err := check.DB.PingContext(ctx); err != nil {
+			problems = append(problems, fmt.Sprintf("mysql: %s", err))
+		}
+	}
+
+	if check.Web3Client != nil {
+		chainId, err := check.Web3Client.ChainID(ctx)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("rpc: %s", err))
+		case chainId.Uint64() != check.ChainId:
+			problems = append(problems, fmt.Sprintf("rpc: chain id is %s rather than %d", chainId, check.ChainId))
+		}
+	}
+
+	if check.Syncer != nil && check.MaxSyncDelay > 0 && (check.SyncLeader == nil || check.SyncLeader.Leading()) {
+		if last := check.Syncer.LastSynced(); time.Since(last) > check.MaxSyncDelay {
+			if last.IsZero() {
+				problems = append(problems, "sync: not synced yet")
+			} else {
+				problems = append(problems, fmt.Sprintf("sync: last synced at %s", last.Format(time.RFC3339)))
+			}
+		}
+	}
+
+	if c.Faucet != nil && check.MaxFaucetFailures > 0 {
+		if failures := c.Faucet.ConsecutiveFailures(); failures >= check.MaxFaucetFailures {
+			problems = append(problems, fmt.Sprintf("faucet: failed %d times in a row", failures))
+		}
+	}
+	return problems
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+type readyResponse struct {
+	Ready    bool                `json:"ready"`
+	Problems map[uint64][]string `json:"problems,omitempty"`
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
+	defer cancel()
+
+	var resp = readyResponse{Ready: true, Problems: make(map[uint64][]string)}
+	for chainId, chain := range s.Chains {
+		if problems := chain.problems(ctx); len(problems) > 0 {
+			resp.Ready, resp.Problems[chainId] = false, problems
+		}
+	}
+
+	var code = http.StatusOK
+	if !resp.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeChainId uint64
+
+func (f fakeChainId) ChainID(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).SetUint64(uint64(f)), nil
+}
+
+type fakeDB struct{ err error }
+
+func (f fakeDB) PingContext(ctx context.Context) error { return f.err }
+
+type fakeSyncer time.Time
+
+func (f fakeSyncer) LastSynced() time.Time { return time.Time(f) }
+
+type fakeLeader bool
+
+func (f fakeLeader) Leading() bool { return bool(f) }
+
+func TestReadyz(t *testing.T) {
+	ready := Readiness{
+		ChainId:      1088,
+		Web3Client:   fakeChainId(1088),
+		DB:           fakeDB{},
+		Syncer:       fakeSyncer(time.Now()),
+		MaxSyncDelay: time.Minute,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *Readiness)
+		want   int
+	}{
+		{"ready", func(r *Readiness) {}, http.StatusOK},
+		{"mysql down", func(r *Readiness) { r.DB = fakeDB{errors.New("connection refused")} }, http.StatusServiceUnavailable},
+		{"wrong chain", func(r *Readiness) { r.Web3Client = fakeChainId(588) }, http.StatusServiceUnavailable},
+		{"sync stale", func(r *Readiness) { r.Syncer = fakeSyncer(time.Now().Add(-time.Hour)) }, http.StatusServiceUnavailable},
+		{"never synced", func(r *Readiness) { r.Syncer = fakeSyncer(time.Time{}) }, http.StatusServiceUnavailable},
+		{"sync unchecked", func(r *Readiness) { r.Syncer, r.MaxSyncDelay = fakeSyncer(time.Time{}), 0 }, http.StatusOK},
+		{"sync standby", func(r *Readiness) { r.Syncer, r.SyncLeader = fakeSyncer(time.Time{}), fakeLeader(false) }, http.StatusOK},
+		{"sync leader stale", func(r *Readiness) { r.Syncer, r.SyncLeader = fakeSyncer(time.Time{}), fakeLeader(true) }, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := ready
+			tt.modify(&check)
+			server := &Server{Chains: map[uint64]*Chain{1088: {Readiness: check}}}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			var resp readyResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Ready != (tt.want == http.StatusOK) || resp.Ready != (len(resp.Problems[1088]) == 0) {
+				t.Errorf("unexpected response %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&Server{}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("code = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/services"
+	"github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	// Chains are keyed by chain id
+	Chains map[uint64]*Chain
+}
+
+type Chain struct {
+	Deposits *services.Deposits
+	// Faucet is nil if it is not enabled on the chain
+	Faucet    *services.Faucet
+	Readiness Readiness
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/budget", s.budget)
+	mux.HandleFunc("/deposits", s.deposits)
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	return mux
+}
+
+// ListenAndServe serves the api until the context is done
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: s.Handler()}
+
+	go func() {
+		<-ctx.Done()
+		newctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = server.Shutdown(newctx)
+	}()
+
+	logrus.Infof("api listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+type budgetResponse struct {
+	*services.BudgetStatus
+	RemainingDrips int     `json:"remainingDrips"`
+	RemainingMetis float64 `json:"remainingMetis"`
+}
+
+// chain finds the chain of the chain param, which can be omitted if only one chain is served
+func (s *Server) chain(r *http.Request) (*Chain, bool) {
+	param := r.URL.Query().Get("chain")
+	if param == "" {
+		if len(s.Chains) != 1 {
+			return nil, false
+		}
+		for _, chain := range s.Chains {
+			return chain, true
+		}
+	}
+	chainId, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	chain, ok := s.Chains[chainId]
+	return chain, ok
+}
+
+func (s *Server) budget(w http.ResponseWriter, r *http.Request) {
+	chain, ok := s.chain(r)
+	if !ok || chain.Faucet == nil {
+		writeError(w, http.StatusNotFound, "faucet is not enabled")
+		return
+	}
+	status, err := chain.Faucet.BudgetStatus(r.Context())
+	if err != nil {
+		logrus.Errorf("api: budget: %s", err)
+		writeError(w, http.StatusInternalServerError, "failed to load budget")
+		return
+	}
+	writeJSON(w, http.StatusOK, budgetResponse{
+		BudgetStatus:   status,
+		RemainingDrips: status.RemainingDrips(),
+		RemainingMetis: status.RemainingMetis(),
+	})
+}
+
+const maxDepositsLimit = 500
+
+func (s *Server) deposits(w http.ResponseWriter, r *http.Request) {
+	chain, ok := s.chain(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "chain is not found")
+		return
+	}
+
+	var query = r.URL.Query()
+	var filter = repository.DepositFilter{To: query.Get("to"), Limit: 50}
+	if param := query.Get("status"); param != "" {
+		status, err := repository.ParseDepositStatus(param)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.Status = &status
+	}
+	if param := query.Get("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 || limit > maxDepositsLimit {
+			writeError(w, http.StatusBadRequest, "limit should be between 1 and 500")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	deposits, err := chain.Deposits.List(r.Context(), filter)
+	if err != nil {
+		logrus.Errorf("api: deposits: %s", err)
+		writeError(w, http.StatusInternalServerError, "failed to load deposits")
+		return
+	}
+	writeJSON(w, http.StatusOK, deposits)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
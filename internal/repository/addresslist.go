@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetAddressListEntry returns the unexpired allow or deny entry of the address,
+// or nil if the address is on neither list.
+func (m Metis) GetAddressListEntry(ctx context.Context, address string) (*AddressListEntry, error) {
+	const query = "SELECT * FROM `address_lists` WHERE `address`=? AND (`expiry` IS NULL OR `expiry`>NOW());"
+
+	var entry AddressListEntry
+	if err := m.db.QueryRowxContext(ctx, query, strings.ToLower(address)).StructScan(&entry); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetAddressListEntry: %w", err)
+	}
+	return &entry, nil
+}
+
+func (m Metis) GetAddressListEntries(ctx context.Context) ([]*AddressListEntry, error) {
+	const query = "SELECT * FROM `address_lists` ORDER BY `kind`,`address`;"
+
+	var entries []*AddressListEntry
+	if err := m.db.SelectContext(ctx, &entries, query); err != nil {
+		return nil, fmt.Errorf("GetAddressListEntries: %w", err)
+	}
+	return entries, nil
+}
+
+// SaveAddressListEntry puts the address on a list, replacing any previous entry.
+func (m Metis) SaveAddressListEntry(ctx context.Context, entry *AddressListEntry, audit *AuditLog) error {
+	return m.inTx(ctx, "SaveAddressListEntry", func(tx *sqlx.Tx) error {
+		const query = "INSERT INTO `address_lists` (`address`,`kind`,`reason`,`expiry`) VALUES (?,?,?,?) " +
+			"ON DUPLICATE KEY UPDATE `kind`=VALUES(`kind`),`reason`=VALUES(`reason`),`expiry`=VALUES(`expiry`);"
+
+		args := []interface{}{strings.ToLower(entry.Address), entry.Kind, entry.Reason, entry.Expiry}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("SaveAddressListEntry: %w", err)
+		}
+		if err := insertAuditLog(ctx, tx, audit); err != nil {
+			return fmt.Errorf("SaveAddressListEntry: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m Metis) DeleteAddressListEntry(ctx context.Context, address string, audit *AuditLog) error {
+	return m.inTx(ctx, "DeleteAddressListEntry", func(tx *sqlx.Tx) error {
+		const query = "DELETE FROM `address_lists` WHERE `address`=?;"
+		res, err := tx.ExecContext(ctx, query, strings.ToLower(address))
+		if err != nil {
+			return fmt.Errorf("DeleteAddressListEntry: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count != 1 {
+			return fmt.Errorf("DeleteAddressListEntry: %s is not listed", address)
+		}
+		if err := insertAuditLog(ctx, tx, audit); err != nil {
+			return fmt.Errorf("DeleteAddressListEntry: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (m Metis) GetDeposits(ctx context.Context, filter DepositFilter) ([]*Deposit, error) {
+	var conds = []string{"`chain_id`=?"}
+	var args = []interface{}{m.chainId}
+	if filter.Status != nil {
+		conds, args = append(conds, "`status`=?"), append(args, *filter.Status)
+	}
+	if filter.To != "" {
+		conds, args = append(conds, "`to`=?"), append(args, strings.ToLower(filter.To))
+	}
+
+	var query = "SELECT * FROM `deposits` WHERE " + strings.Join(conds, " AND ") + " ORDER BY `id` DESC LIMIT ?;"
+	args = append(args, filter.Limit)
+
+	var deposits []*Deposit
+	if err := m.db.SelectContext(ctx, &deposits, query, args...); err != nil {
+		return nil, fmt.Errorf("GetDeposits: %w", err)
+	}
+	return deposits, nil
+}
+
+// ChangeDepositStatus moves a deposit from one status to another and records the audit log
+func (m Metis) ChangeDepositStatus(ctx context.Context, id uint64, from, to DepositStatus, audit *AuditLog) error {
+	return m.inTx(ctx, "ChangeDepositStatus", func(tx *sqlx.Tx) error {
+		const query = "UPDATE `deposits` SET `status`=? WHERE `id`=? AND `chain_id`=? AND `status`=?;"
+		res, err := tx.ExecContext(ctx, query, to, id, m.chainId, from)
+		if err != nil {
+			return fmt.Errorf("ChangeDepositStatus: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count != 1 {
+			return fmt.Errorf("ChangeDepositStatus: deposit %d is not found or not %s", id, from)
+		}
+		if err := insertAuditLog(ctx, tx, audit); err != nil {
+			return fmt.Errorf("ChangeDepositStatus: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m Metis) GetDrip(ctx context.Context, txid string) (*Drip, error) {
+	const query = "SELECT * FROM `drips` WHERE `chain_id`=? AND `txid`=?;"
+
+	var drip Drip
+	if err := m.db.QueryRowxContext(ctx, query, m.chainId, txid).StructScan(&drip); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("GetDrip: drip %s is not found", txid)
+		}
+		return nil, fmt.Errorf("GetDrip: %w", err)
+	}
+	return &drip, nil
+}
+
+// SetHeight moves the sync cursor, syncing resumes from the next block.
+// A running syncer overwrites it with its own height, so it should be stopped first.
+func (m Metis) SetHeight(ctx context.Context, number uint64, audit *AuditLog) error {
+	return m.inTx(ctx, "SetHeight", func(tx *sqlx.Tx) error {
+		const query = "UPDATE `height` SET `number`=?,`blockhash`=? WHERE `chain_id`=?;"
+		res, err := tx.ExecContext(ctx, query, number, "", m.chainId)
+		if err != nil {
+			return fmt.Errorf("SetHeight: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count != 1 {
+			return fmt.Errorf("SetHeight: height is not initialized")
+		}
+		if err := insertAuditLog(ctx, tx, audit); err != nil {
+			return fmt.Errorf("SetHeight: %w", err)
+		}
+		return nil
+	})
+}
+
+func (m Metis) AddAuditLog(ctx context.Context, audit *AuditLog) error {
+	return m.inTx(ctx, "AddAuditLog", func(tx *sqlx.Tx) error {
+		return insertAuditLog(ctx, tx, audit)
+	})
+}
+
+func (m Metis) GetStats(ctx context.Context) (*Stats, error) {
+	var stats = &Stats{Deposits: make(map[DepositStatus]uint64)}
+
+	const heightQuery = "SELECT `number` FROM `height` WHERE `chain_id`=?;"
+	if err := m.db.QueryRowContext(ctx, heightQuery, m.chainId).Scan(&stats.Height); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("GetStats: get height: %w", err)
+	}
+
+	const depositsQuery = "SELECT `status`,COUNT(*) FROM `deposits` WHERE `chain_id`=? GROUP BY `status`;"
+	rows, err := m.db.QueryContext(ctx, depositsQuery, m.chainId)
+	if err != nil {
+		return nil, fmt.Errorf("GetStats: count deposits: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status DepositStatus
+		var count uint64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("GetStats: count deposits: %w", err)
+		}
+		stats.Deposits[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetStats: count deposits: %w", err)
+	}
+
+	const dripsQuery = "SELECT COUNT(*),COALESCE(SUM(`amount`),0) FROM `drips` WHERE `chain_id`=?;"
+	if err := m.db.QueryRowContext(ctx, dripsQuery, m.chainId).Scan(&stats.Drips, &stats.DripsAmount); err != nil {
+		return nil, fmt.Errorf("GetStats: count drips: %w", err)
+	}
+	return stats, nil
+}
+
+// the tables which had rows before multiple chains were supported
+var legacyChainTables = []string{"height", "deposits", "drips"}
+
+// BackfillChainId assigns the rows without a chain id to the chain, they were written
+// before multiple chains were supported by a faucet of a single chain
+func (m Metis) BackfillChainId(ctx context.Context) (int64, error) {
+	var total int64
+	err := m.inTx(ctx, "BackfillChainId", func(tx *sqlx.Tx) error {
+		for _, table := range legacyChainTables {
+			res, err := tx.ExecContext(ctx, "UPDATE `"+table+"` SET `chain_id`=? WHERE `chain_id` IS NULL;", m.chainId)
+			if err != nil {
+				return fmt.Errorf("BackfillChainId: %s: %w", table, err)
+			}
+			count, _ := res.RowsAffected()
+			total += count
+		}
+		return nil
+	})
+	return total, err
+}
+
+// CountNoChainRows counts the rows which have not been assigned to a chain by BackfillChainId
+func (m Metis) CountNoChainRows(ctx context.Context) (int64, error) {
+	var total int64
+	for _, table := range legacyChainTables {
+		var count int64
+		if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `"+table+"` WHERE `chain_id` IS NULL;").Scan(&count); err != nil {
+			return 0, fmt.Errorf("CountNoChainRows: %s: %w", table, err)
+		}
+		total += count
+	}
+	return total, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func countAuditLogs(t *testing.T, repo Metis, action string) int {
+	var count int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM `audit_logs` WHERE `action`=?;", action).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestChangeDepositStatus(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01", "0x02")
+
+	audit := &AuditLog{Operator: "tester", Action: "deposit ignore", Target: "1"}
+	if err := repo.ChangeDepositStatus(ctx, deposits[0].Id, DepositStatusUnprocessed, DepositStatusIgnore, audit); err != nil {
+		t.Fatal(err)
+	}
+	// the deposit is not unprocessed anymore, nothing is changed or audited
+	if err := repo.ChangeDepositStatus(ctx, deposits[0].Id, DepositStatusUnprocessed, DepositStatusIgnore, audit); err == nil {
+		t.Error("ChangeDepositStatus() of a deposit in another status should fail")
+	}
+	if count := countAuditLogs(t, repo, "deposit ignore"); count != 1 {
+		t.Errorf("%d audit logs, want 1", count)
+	}
+
+	status := DepositStatusIgnore
+	ignored, err := repo.GetDeposits(ctx, DepositFilter{Status: &status, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ignored) != 1 || ignored[0].Id != deposits[0].Id {
+		t.Errorf("GetDeposits(ignore) = %v, want the first deposit", depositIds(ignored))
+	}
+	listed, err := repo.GetDeposits(ctx, DepositFilter{To: "0x02", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Id != deposits[1].Id {
+		t.Errorf("GetDeposits(to 0x02) = %v, want the second deposit", depositIds(listed))
+	}
+}
+
+func TestSetHeight(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	audit := &AuditLog{Operator: "tester", Action: "height set", Target: "height"}
+
+	if err := repo.SetHeight(ctx, 100, audit); err == nil {
+		t.Error("SetHeight() should fail before the height is initialized")
+	}
+	if _, err := repo.InitHeight(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetHeight(ctx, 100, audit); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.GetStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Height != 100 {
+		t.Errorf("height = %d, want 100", stats.Height)
+	}
+	if count := countAuditLogs(t, repo, "height set"); count != 1 {
+		t.Errorf("%d audit logs, want 1", count)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	saveTestDeposits(t, repo, "0x01", "0x02", "0x03")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 1)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	drip := &Drip{Pid: claimed[0].Id, Txid: "0xabc", From: "0xf0", To: claimed[0].To, Amount: 0.01, Rawtx: []byte{1}}
+	if err := repo.NewDrip(ctx, claimed[0], drip); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.GetStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deposits[DepositStatusUnprocessed] != 2 || stats.Deposits[DepositStatusProcessing] != 1 || stats.Drips != 1 || stats.DripsAmount != 0.01 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
@@ -15,9 +17,29 @@ const (
 	DepositStatusIgnore
 )
 
+var depositStatusNames = []string{"unprocessed", "processing", "done", "ignore"}
+
+func (s DepositStatus) String() string {
+	if int(s) < len(depositStatusNames) {
+		return depositStatusNames[s]
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+func ParseDepositStatus(name string) (DepositStatus, error) {
+	for i, item := range depositStatusNames {
+		if item == name {
+			return DepositStatus(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown deposit status %q", name)
+}
+
 type Deposit struct {
 	Id        uint64        `db:"id"`
+	ChainId   uint64        `db:"chain_id"`
 	Txid      string        `db:"txid"`
+	LogIndex  sql.NullInt64 `db:"log_index"`
 	Height    uint64        `db:"height"`
 	L1Token   string        `db:"l1token"`
 	L2Token   string        `db:"l2token"`
@@ -27,8 +49,20 @@ type Deposit struct {
 	Status    DepositStatus `db:"status"`
 	CreatedAt time.Time     `db:"ctime"`
 	UpdatedAt time.Time     `db:"mtime"`
+
+	// ClaimOwner is the faucet worker processing the deposit until ClaimExpiry
+	ClaimOwner  string       `db:"claim_owner"`
+	ClaimExpiry sql.NullTime `db:"claim_expiry"`
+
+	// CheckMode is the block the account state of the receiver was checked at, empty if it was not checked
+	CheckMode string `db:"check_mode"`
 }
 
+const (
+	CheckModeHead    = "head"
+	CheckModeDeposit = "deposit"
+)
+
 type Height struct {
 	Number    uint64 `db:"number"`
 	Blockhash string `db:"blockhash"`
@@ -36,6 +70,7 @@ type Height struct {
 
 type Drip struct {
 	Pid       uint64    `db:"pid"`
+	ChainId   uint64    `db:"chain_id"`
 	Txid      string    `db:"txid"`
 	From      string    `db:"from"`
 	To        string    `db:"to"`
@@ -43,3 +78,119 @@ type Drip struct {
 	Rawtx     []byte    `db:"rawtx"`
 	CreatedAt time.Time `db:"ctime"`
 }
+
+// ShadowDrip is a decision of the faucet in dry run, Txid is empty and Reason is set if the deposit is skipped
+type ShadowDrip struct {
+	Pid       uint64    `db:"pid"`
+	ChainId   uint64    `db:"chain_id"`
+	Txid      string    `db:"txid"`
+	From      string    `db:"from"`
+	To        string    `db:"to"`
+	Amount    float64   `db:"amount"`
+	Rawtx     []byte    `db:"rawtx"`
+	Reason    string    `db:"reason"`
+	CheckMode string    `db:"check_mode"`
+	CreatedAt time.Time `db:"ctime"`
+	UpdatedAt time.Time `db:"mtime"`
+}
+
+type AddressListKind uint8
+
+const (
+	AddressListAllow AddressListKind = iota + 1
+	AddressListDeny
+)
+
+func (k AddressListKind) String() string {
+	switch k {
+	case AddressListAllow:
+		return "allow"
+	case AddressListDeny:
+		return "deny"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(k))
+}
+
+type AddressListEntry struct {
+	Address   string          `db:"address"`
+	Kind      AddressListKind `db:"kind"`
+	Reason    string          `db:"reason"`
+	Expiry    sql.NullTime    `db:"expiry"`
+	CreatedAt time.Time       `db:"ctime"`
+	UpdatedAt time.Time       `db:"mtime"`
+}
+
+type FundingCluster struct {
+	From       string    `db:"from"`
+	Recipients int       `db:"recipients"`
+	Drips      int       `db:"drips"`
+	FirstSeen  time.Time `db:"first_seen"`
+	LastSeen   time.Time `db:"last_seen"`
+}
+
+type AuditLog struct {
+	Id        uint64    `db:"id"`
+	Operator  string    `db:"operator"`
+	Action    string    `db:"action"`
+	Target    string    `db:"target"`
+	Detail    string    `db:"detail"`
+	CreatedAt time.Time `db:"ctime"`
+}
+
+type DepositFilter struct {
+	Status *DepositStatus
+	To     string
+	Limit  int
+}
+
+type Stats struct {
+	Height      uint64                   `json:"height"`
+	Deposits    map[DepositStatus]uint64 `json:"deposits"`
+	Drips       uint64                   `json:"drips"`
+	DripsAmount float64                  `json:"dripsAmount"`
+}
+
+// Token is the metadata of an L2 standard token, which never changes after deployment
+type Token struct {
+	ChainId  uint64 `db:"chain_id"`
+	Address  string `db:"address"`
+	L1Token  string `db:"l1token"`
+	Name     string `db:"name"`
+	Symbol   string `db:"symbol"`
+	Decimals uint8  `db:"decimals"`
+	// Standard is true if the token supports IL2StandardERC20 and has an l1Token
+	Standard bool `db:"standard"`
+	// CheckedAt is when the metadata was last read from the token contract
+	CheckedAt time.Time `db:"checked_at"`
+	CreatedAt time.Time `db:"ctime"`
+}
+
+// WebhookStatus is the state of the webhook delivery of an outbox event
+type WebhookStatus uint8
+
+const (
+	WebhookStatusPending WebhookStatus = iota
+	WebhookStatusDelivered
+	// WebhookStatusFailed means the delivery is given up after too many attempts
+	WebhookStatusFailed
+	// WebhookStatusDisabled means webhooks were disabled when the event was written, it's never delivered
+	WebhookStatusDisabled
+)
+
+// OutboxEvent is written in the transaction of the change it describes, an event is stored once per DedupKey.
+// It's delivered to the webhook and published to the sink apart, at least once for each of them.
+// Status, Attempts, NextAt and LastError are the state of the webhook delivery, PublishedAt is the one of the sink.
+type OutboxEvent struct {
+	Id          uint64        `db:"id" json:"id"`
+	ChainId     uint64        `db:"chain_id" json:"chainId"`
+	Event       string        `db:"event" json:"event"`
+	DedupKey    string        `db:"dedup_key" json:"-"`
+	Payload     []byte        `db:"payload" json:"-"`
+	Status      WebhookStatus `db:"status" json:"-"`
+	Attempts    int           `db:"attempts" json:"-"`
+	NextAt      time.Time     `db:"next_at" json:"-"`
+	LastError   string        `db:"last_error" json:"-"`
+	PublishedAt sql.NullTime  `db:"published_at" json:"-"`
+	CreatedAt   time.Time     `db:"ctime" json:"createdAt"`
+	UpdatedAt   time.Time     `db:"mtime" json:"-"`
+}
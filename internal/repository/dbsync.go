@@ -5,17 +5,18 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 )
 
 func (t Metis) InitHeight(ctx context.Context) (uint64, error) {
-	const query = "SELECT `number` FROM `height`;"
+	const query = "SELECT `number` FROM `height` WHERE `chain_id`=?;"
 
 	var hegiht uint64
-	if err := t.db.QueryRowxContext(ctx, query).Scan(&hegiht); err != nil {
+	if err := t.db.QueryRowxContext(ctx, query, t.chainId).Scan(&hegiht); err != nil {
 		if err == sql.ErrNoRows {
-			const init = "INSERT INTO `height` (`number`,`blockhash`) VALUES (?,?);"
-			if _, err := t.db.ExecContext(ctx, init, 0, ""); err != nil {
+			const init = "INSERT INTO `height` (`chain_id`,`number`,`blockhash`) VALUES (?,?,?);"
+			if _, err := t.db.ExecContext(ctx, init, t.chainId, 0, ""); err != nil {
 				return 0, fmt.Errorf("InitHeight: init height %w", err)
 			}
 			return 0, nil
@@ -25,32 +26,126 @@ func (t Metis) InitHeight(ctx context.Context) (uint64, error) {
 	return hegiht + 1, nil
 }
 
-func (m Metis) SaveSyncedData(ctx context.Context, deposits []*Deposit, tail *Height) error {
-	tx, err := m.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("SaveSyncedData: begin tx %w", err)
-	}
+// SaveSyncedData stores the deposits and the outbox events of a range, then moves the sync cursor to its tail
+func (m Metis) SaveSyncedData(ctx context.Context, deposits []*Deposit, tail *Height, events ...*OutboxEvent) error {
+	return m.inTx(ctx, "SaveSyncedData", func(tx *sqlx.Tx) error {
+		if _, _, err := m.upsertDeposits(ctx, tx, deposits); err != nil {
+			return fmt.Errorf("SaveSyncedData: %w", err)
+		}
+		if err := m.insertOutboxEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("SaveSyncedData: %w", err)
+		}
+
+		const updateHeightQuery = "UPDATE `height` SET `number`=?,`blockhash`=? WHERE `chain_id`=?;"
+		if _, err := tx.ExecContext(ctx, updateHeightQuery, tail.Number, tail.Blockhash, m.chainId); err != nil {
+			return fmt.Errorf("SaveSyncedData: update height data: %w", err)
+		}
+		return nil
+	})
+}
+
+// a deposit is identified by its txid and log index, storing it again keeps the stored row as it is
+const upsertDepositQuery = "INSERT INTO `deposits` (`chain_id`,`height`,`txid`,`log_index`,`l1token`,`l2token`,`from`,`to`,`amount`,`status`) " +
+	"VALUES (?,?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`;"
 
-	defer func() {
-		if err == nil {
-			return
+func (m Metis) upsertDepositArgs(item *Deposit) []interface{} {
+	return []interface{}{m.chainId, item.Height, item.Txid, item.LogIndex, item.L1Token, item.L2Token, item.From, item.To, item.Amount, item.Status}
+}
+
+// upsertDeposits stores the deposits and returns how many are inserted, those which are stored already
+// are kept as they are. The rows stored before the log index was recorded get theirs first,
+// their NULL log index would never collide with the unique key. The transactions whose rows can't be
+// matched with the events are skipped and returned, storing their events could store a deposit twice.
+func (m Metis) upsertDeposits(ctx context.Context, tx *sqlx.Tx, deposits []*Deposit) (int, []string, error) {
+	var txids []string
+	var groups = make(map[string][]*Deposit)
+	for _, item := range deposits {
+		if _, ok := groups[item.Txid]; !ok {
+			txids = append(txids, item.Txid)
+		}
+		groups[item.Txid] = append(groups[item.Txid], item)
+	}
+	var skipped []string
+	var mismatched = make(map[string]bool)
+	for _, txid := range txids {
+		matched, err := m.backfillLogIndex(ctx, tx, txid, groups[txid])
+		if err != nil {
+			return 0, nil, err
 		}
-		if rollbackError := tx.Rollback(); rollbackError != nil {
-			logrus.Errorf("SaveSyncedData: rollback: %s", rollbackError)
+		if !matched {
+			skipped = append(skipped, txid)
+			mismatched[txid] = true
 		}
-	}()
+	}
 
-	const insertDepositQuery = "INSERT INTO `deposits` (`height`,`txid`,`l1token`,`l2token`,`from`,`to`,`amount`,`status`) VALUES (?,?,?,?,?,?,?,?);"
+	var inserted int
 	for _, item := range deposits {
-		args := []interface{}{item.Height, item.Txid, item.L1Token, item.L2Token, item.From, item.To, item.Amount, item.Status}
-		if _, err := tx.ExecContext(ctx, insertDepositQuery, args...); err != nil {
-			return fmt.Errorf("SaveSyncedData: insert deposit data: %w", err)
+		if mismatched[item.Txid] {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, upsertDepositQuery, m.upsertDepositArgs(item)...)
+		if err != nil {
+			return 0, nil, fmt.Errorf("insert deposit data: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count == 1 {
+			inserted++
 		}
 	}
+	return inserted, skipped, nil
+}
+
+// SaveReindexedDeposits stores the deposits which are not stored yet and returns how many are inserted,
+// with the transactions skipped because their stored rows don't match their events.
+func (m Metis) SaveReindexedDeposits(ctx context.Context, deposits []*Deposit) (int, []string, error) {
+	var inserted int
+	var skipped []string
+	err := m.inTx(ctx, "SaveReindexedDeposits", func(tx *sqlx.Tx) (err error) {
+		if inserted, skipped, err = m.upsertDeposits(ctx, tx, deposits); err != nil {
+			return fmt.Errorf("SaveReindexedDeposits: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return inserted, skipped, nil
+}
 
-	const updateHeightQuery = "UPDATE `height` SET `number`=?,`blockhash`=?;"
-	if _, err := tx.ExecContext(ctx, updateHeightQuery, tail.Number, tail.Blockhash); err != nil {
-		return fmt.Errorf("SaveSyncedData: update height data: %w", err)
+// backfillLogIndex sets the log index of rows stored before it was recorded.
+// Those rows hold every deposit of the transaction, inserted in the log order.
+// It reports false if the rows can't be matched with the events, they are left as they are.
+func (m Metis) backfillLogIndex(ctx context.Context, tx *sqlx.Tx, txid string, deposits []*Deposit) (bool, error) {
+	const query = "SELECT `id` FROM `deposits` WHERE `chain_id`=? AND `txid`=? AND `log_index` IS NULL ORDER BY `id` FOR UPDATE;"
+	var ids []uint64
+	if err := tx.SelectContext(ctx, &ids, query, m.chainId, txid); err != nil {
+		return false, fmt.Errorf("backfill log index: %w", err)
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+	if len(ids) != len(deposits) {
+		logrus.Warnf("Skipping tx %s, it has %d stored deposits without a log index but %d events", txid, len(ids), len(deposits))
+		return false, nil
 	}
-	return tx.Commit()
+
+	const update = "UPDATE `deposits` SET `log_index`=? WHERE `id`=?;"
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx, update, deposits[i].LogIndex, id); err != nil {
+			return false, fmt.Errorf("backfill log index: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// SaveDeposits stores the deposits without moving the sync cursor
+func (m Metis) SaveDeposits(ctx context.Context, deposits []*Deposit, events ...*OutboxEvent) error {
+	return m.inTx(ctx, "SaveDeposits", func(tx *sqlx.Tx) error {
+		if _, _, err := m.upsertDeposits(ctx, tx, deposits); err != nil {
+			return fmt.Errorf("SaveDeposits: %w", err)
+		}
+		if err := m.insertOutboxEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("SaveDeposits: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+)
+
+// saveLegacyDeposits stores deposits the way they were stored before the log index was recorded
+func saveLegacyDeposits(t *testing.T, repo Metis, deposits ...*Deposit) {
+	const query = "INSERT INTO `deposits` (`chain_id`,`height`,`txid`,`l1token`,`l2token`,`from`,`to`,`amount`,`status`) VALUES (?,?,?,?,?,?,?,?,?);"
+	for _, item := range deposits {
+		if _, err := repo.db.Exec(query, repo.chainId, item.Height, item.Txid, item.L1Token, item.L2Token, item.From, item.To, item.Amount, item.Status); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestEvent(txid int, logIndex int64) *Deposit {
+	return &Deposit{
+		Height:   100,
+		Txid:     fmt.Sprintf("0x%064x", txid),
+		LogIndex: sql.NullInt64{Int64: logIndex, Valid: true},
+		To:       fmt.Sprintf("0x%040x", logIndex+1),
+		Amount:   bigint.New(1),
+		Status:   DepositStatusUnprocessed,
+	}
+}
+
+func countDeposits(t *testing.T, repo Metis) int {
+	var count int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM `deposits` WHERE `chain_id`=?;", repo.chainId).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestSaveSyncedData_Twice(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	if _, err := repo.InitHeight(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a transaction of two deposits was synced before the upgrade
+	events := []*Deposit{newTestEvent(1, 0), newTestEvent(1, 1), newTestEvent(2, 0)}
+	saveLegacyDeposits(t, repo, events[0], events[1])
+
+	tail := &Height{Number: 100, Blockhash: "0xabc"}
+	for i := 0; i < 2; i++ {
+		if err := repo.SaveSyncedData(ctx, events, tail); err != nil {
+			t.Fatal(err)
+		}
+		if count := countDeposits(t, repo); count != 3 {
+			t.Fatalf("%d deposits after saving the events %d times, want 3", count, i+1)
+		}
+	}
+
+	var nulls int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM `deposits` WHERE `log_index` IS NULL;").Scan(&nulls); err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 0 {
+		t.Errorf("%d legacy deposits have no log index", nulls)
+	}
+}
+
+func TestSaveReindexedDeposits_Twice(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	if _, err := repo.InitHeight(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tail := &Height{Number: 500, Blockhash: "0xabc"}
+	if err := repo.SaveSyncedData(ctx, nil, tail); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first transaction was synced before the upgrade, the third one lost a deposit
+	var events []*Deposit
+	for _, item := range []*Deposit{newTestEvent(1, 0), newTestEvent(1, 1), newTestEvent(2, 0), newTestEvent(3, 0), newTestEvent(3, 1)} {
+		item.Status = DepositStatusIgnore
+		events = append(events, item)
+	}
+	saveLegacyDeposits(t, repo, events[0], events[1], events[3])
+
+	for i := 0; i < 2; i++ {
+		inserted, skipped, err := repo.SaveReindexedDeposits(ctx, events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 - i; inserted != want {
+			t.Errorf("run %d inserted %d deposits, want %d", i+1, inserted, want)
+		}
+		if len(skipped) != 1 || skipped[0] != events[3].Txid {
+			t.Errorf("run %d skipped %v, want the third transaction", i+1, skipped)
+		}
+		if count := countDeposits(t, repo); count != 4 {
+			t.Fatalf("%d deposits after reindexing %d times, want 4", count, i+1)
+		}
+	}
+
+	if height, err := repo.InitHeight(ctx); err != nil || height != 501 {
+		t.Errorf("InitHeight() = %d, %v, want the cursor left at 500", height, err)
+	}
+	if claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 10); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d reindexed deposits, %v, want none to be dripped", len(claimed), err)
+	}
+}
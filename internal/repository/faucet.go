@@ -2,95 +2,148 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/jmoiron/sqlx"
 )
 
-type DepositTxStream struct {
-	Data  *Deposit
-	Error error
-}
-
-func (m Metis) GetDepositTxStream(ctx context.Context, status DepositStatus) <-chan DepositTxStream {
-	var stream = make(chan DepositTxStream, 5)
-	const query = "SELECT * FROM `deposits` WHERE `status`=? LIMIT 20;"
-
-	go func() {
-		defer close(stream)
+// ClaimDeposits claims unprocessed deposits for the owner until the ttl expires, skipping the deposits
+// claimed by other workers, so that several workers can process deposits without duplicates.
+// The unexpired claims of the owner itself are taken again, e.g. after a restart.
+func (m Metis) ClaimDeposits(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*Deposit, error) {
+	var deposits []*Deposit
+	err := m.inTx(ctx, "ClaimDeposits", func(tx *sqlx.Tx) error {
+		const selectQuery = "SELECT * FROM `deposits` WHERE `chain_id`=? AND `status`=? AND (`claim_expiry` IS NULL OR `claim_expiry`<=NOW(3) OR `claim_owner`=?) " +
+			"ORDER BY `id` LIMIT ? FOR UPDATE SKIP LOCKED;"
+		if err := tx.SelectContext(ctx, &deposits, selectQuery, m.chainId, DepositStatusUnprocessed, owner, limit); err != nil {
+			return fmt.Errorf("ClaimDeposits: %w", err)
+		}
+		if len(deposits) == 0 {
+			return nil
+		}
 
-		rows, err := m.db.QueryxContext(ctx, query, status)
+		var ids = make([]uint64, 0, len(deposits))
+		for _, item := range deposits {
+			ids = append(ids, item.Id)
+			item.ClaimOwner = owner
+		}
+		query, args, err := sqlx.In("UPDATE `deposits` SET `claim_owner`=?,`claim_expiry`=DATE_ADD(NOW(3),INTERVAL ? MICROSECOND) WHERE `id` IN (?);",
+			owner, ttl.Microseconds(), ids)
 		if err != nil {
-			select {
-			case <-ctx.Done():
-			case stream <- DepositTxStream{Error: err}:
-			}
-			return
+			return fmt.Errorf("ClaimDeposits: %w", err)
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var tx Deposit
-			if err := rows.StructScan(&tx); err != nil {
-				select {
-				case <-ctx.Done():
-				case stream <- DepositTxStream{Error: err}:
-				}
-				return
-			}
-			select {
-			case <-ctx.Done():
-			case stream <- DepositTxStream{Data: &tx}:
-			}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("ClaimDeposits: %w", err)
 		}
-	}()
-
-	return stream
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deposits, nil
 }
 
-func (m Metis) HasGotDrip(ctx context.Context, address string) (bool, error) {
-	const query = "SELECT COUNT(*) FROM `drips` WHERE `to`=?;"
+// HasGotDrip reports whether the address has got no drip, the drip of the deposit pid itself is not counted
+// so a dry run judges the deposits already processed by the faucet the same way
+func (m Metis) HasGotDrip(ctx context.Context, address string, pid uint64) (bool, error) {
+	const query = "SELECT COUNT(*) FROM `drips` WHERE `chain_id`=? AND `to`=? AND `pid`<>?;"
 	var count int
-	if err := m.db.QueryRowContext(ctx, query, address).Scan(&count); err != nil {
+	if err := m.db.QueryRowContext(ctx, query, m.chainId, address, pid).Scan(&count); err != nil {
 		return false, fmt.Errorf("HasGotDrip: %w", err)
 	}
 	return count == 0, nil
 }
 
-func (m Metis) NewDrip(ctx context.Context, deposit *Deposit, drip *Drip) error {
-	tx, err := m.db.BeginTx(ctx, nil)
+// GetDripsOf returns the amounts and the times of the drips given to the deposits by deposit id
+func (m Metis) GetDripsOf(ctx context.Context, pids []uint64) (map[uint64]*Drip, error) {
+	var drips = make(map[uint64]*Drip)
+	if len(pids) == 0 {
+		return drips, nil
+	}
+	query, args, err := sqlx.In("SELECT `pid`,`amount`,`ctime` FROM `drips` WHERE `chain_id`=? AND `pid` IN (?);", m.chainId, pids)
 	if err != nil {
-		return fmt.Errorf("SaveSyncingData: begin tx %w", err)
+		return nil, fmt.Errorf("GetDripsOf: %w", err)
 	}
+	var list []*Drip
+	if err := m.db.SelectContext(ctx, &list, query, args...); err != nil {
+		return nil, fmt.Errorf("GetDripsOf: %w", err)
+	}
+	for _, item := range list {
+		drips[item.Pid] = item
+	}
+	return drips, nil
+}
 
-	defer func() {
-		if err == nil {
-			return
-		}
-		if rollbackError := tx.Rollback(); rollbackError != nil {
-			logrus.Errorf("SaveSyncingData: rollback: %s", rollbackError)
-		}
-	}()
-
-	var status = DepositStatusIgnore
-	if drip != nil {
-		const insertDripQuery = "INSERT INTO `drips` (`pid`,`txid`,`from`,`to`,`amount`,`rawtx`) VALUES (?,?,?,?,?,?);"
-		if drip.Pid != deposit.Id {
-			return fmt.Errorf("NewDrip: drip id is not same with deposit id")
-		}
-		args := []interface{}{drip.Pid, drip.Txid, drip.From, drip.To, drip.Amount, drip.Rawtx}
-		if _, err := tx.ExecContext(ctx, insertDripQuery, args...); err != nil {
-			return fmt.Errorf("NewDrip: save drip: %w", err)
-		}
-		status = DepositStatusProcessing
+// GetDripReceivers returns the receivers of the drips of the deposits up to the id
+func (m Metis) GetDripReceivers(ctx context.Context, toId uint64) ([]string, error) {
+	const query = "SELECT DISTINCT `to` FROM `drips` WHERE `chain_id`=? AND `pid`<=?;"
+	var receivers []string
+	if err := m.db.SelectContext(ctx, &receivers, query, m.chainId, toId); err != nil {
+		return nil, fmt.Errorf("GetDripReceivers: %w", err)
 	}
+	return receivers, nil
+}
 
-	const updateDepositStatusQuery = "UPDATE `deposits` SET `status`=? WHERE id=?;"
-	if _, err := tx.ExecContext(ctx, updateDepositStatusQuery, status, deposit.Id); err != nil {
-		return fmt.Errorf("NewDrip: update deposit tx status: %w", err)
+// GetDripUsage returns the count and the total amount of drips given within the duration.
+// The window is computed by the clock of mysql, which also sets the ctime of the drips,
+// so it doesn't depend on the time zone of the connection.
+func (m Metis) GetDripUsage(ctx context.Context, within time.Duration) (int, float64, error) {
+	const query = "SELECT COUNT(*),COALESCE(SUM(`amount`),0) FROM `drips` WHERE `chain_id`=? AND `ctime`>=NOW()-INTERVAL ? SECOND;"
+	var count int
+	var amount float64
+	if err := m.db.QueryRowContext(ctx, query, m.chainId, seconds(within)).Scan(&count, &amount); err != nil {
+		return 0, 0, fmt.Errorf("GetDripUsage: %w", err)
 	}
+	return count, amount, nil
+}
+
+// seconds rounds the window up to whole seconds for an interval of mysql
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+var (
+	// ErrDuplicateDrip is returned by NewDrip if the receiver has got a drip
+	ErrDuplicateDrip = errors.New("receiver has got a drip")
+	// ErrClaimLost is returned by NewDrip if the deposit is not claimed by the worker anymore
+	ErrClaimLost = errors.New("deposit is not claimed by the worker")
+)
 
-	return tx.Commit()
+func (m Metis) NewDrip(ctx context.Context, deposit *Deposit, drip *Drip, events ...*OutboxEvent) error {
+	return m.inTx(ctx, "NewDrip", func(tx *sqlx.Tx) error {
+		var status = DepositStatusIgnore
+		if drip != nil {
+			const insertDripQuery = "INSERT INTO `drips` (`pid`,`chain_id`,`txid`,`from`,`to`,`amount`,`rawtx`) VALUES (?,?,?,?,?,?,?);"
+			if drip.Pid != deposit.Id {
+				return fmt.Errorf("NewDrip: drip id is not same with deposit id")
+			}
+			args := []interface{}{drip.Pid, m.chainId, drip.Txid, drip.From, drip.To, drip.Amount, drip.Rawtx}
+			if _, err := tx.ExecContext(ctx, insertDripQuery, args...); err != nil {
+				// the unique key on the receiver keeps concurrent workers from dripping to it twice
+				if isDuplicateKey(err, "uk_chain_id_to") {
+					return fmt.Errorf("NewDrip: %w", ErrDuplicateDrip)
+				}
+				return fmt.Errorf("NewDrip: save drip: %w", err)
+			}
+			status = DepositStatusProcessing
+		}
+
+		// the deposit is only updated by the worker which claims it
+		const updateDepositStatusQuery = "UPDATE `deposits` SET `status`=?,`check_mode`=? WHERE `id`=? AND `status`=? AND `claim_owner`=?;"
+		res, err := tx.ExecContext(ctx, updateDepositStatusQuery, status, deposit.CheckMode, deposit.Id, DepositStatusUnprocessed, deposit.ClaimOwner)
+		if err != nil {
+			return fmt.Errorf("NewDrip: update deposit tx status: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count != 1 {
+			return fmt.Errorf("NewDrip: deposit %d: %w", deposit.Id, ErrClaimLost)
+		}
+		if err := m.insertOutboxEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("NewDrip: %w", err)
+		}
+		return nil
+	})
 }
 
 type PendingDrip struct {
@@ -106,12 +159,12 @@ type PendingDripStream struct {
 
 func (m Metis) GetPendingDripsStream(ctx context.Context) <-chan PendingDripStream {
 	var stream = make(chan PendingDripStream, 5)
-	const query = "SELECT A.id as id,B.txid as txid,B.rawtx as rawtx  FROM `deposits` as A INNER JOIN `drips` as B ON A.id=B.pid WHERE `status`=? LIMIT 20;"
+	const query = "SELECT A.id as id,B.txid as txid,B.rawtx as rawtx  FROM `deposits` as A INNER JOIN `drips` as B ON A.id=B.pid WHERE A.`chain_id`=? AND `status`=? LIMIT 20;"
 
 	go func() {
 		defer close(stream)
 
-		rows, err := m.db.QueryxContext(ctx, query, DepositStatusProcessing)
+		rows, err := m.db.QueryxContext(ctx, query, m.chainId, DepositStatusProcessing)
 		if err != nil {
 			select {
 			case <-ctx.Done():
@@ -140,14 +193,19 @@ func (m Metis) GetPendingDripsStream(ctx context.Context) <-chan PendingDripStre
 	return stream
 }
 
-func (m Metis) UpdateDripStatus(ctx context.Context, id uint64, status DepositStatus) error {
-	const query = "UPDATE `deposits` SET `status`=? WHERE `id`=?;"
-	res, err := m.db.ExecContext(ctx, query, status, id)
-	if err != nil {
-		return fmt.Errorf("UpdateDripStatus: %w", err)
-	}
-	if count, _ := res.RowsAffected(); count != 1 {
-		return fmt.Errorf("UpdateDripStatus: affected row length should be 1")
-	}
-	return nil
+func (m Metis) UpdateDripStatus(ctx context.Context, id uint64, status DepositStatus, events ...*OutboxEvent) error {
+	return m.inTx(ctx, "UpdateDripStatus", func(tx *sqlx.Tx) error {
+		const query = "UPDATE `deposits` SET `status`=? WHERE `id`=?;"
+		res, err := tx.ExecContext(ctx, query, status, id)
+		if err != nil {
+			return fmt.Errorf("UpdateDripStatus: %w", err)
+		}
+		if count, _ := res.RowsAffected(); count != 1 {
+			return fmt.Errorf("UpdateDripStatus: affected row length should be 1")
+		}
+		if err := m.insertOutboxEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("UpdateDripStatus: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func depositIds(deposits []*Deposit) []uint64 {
+	var ids []uint64
+	for _, item := range deposits {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+func TestClaimDeposits(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01", "0x02", "0x03")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 || claimed[0].Id != deposits[0].Id || claimed[1].Id != deposits[1].Id || claimed[0].ClaimOwner != "a" {
+		t.Fatalf("a claims %v, want the first 2 deposits", depositIds(claimed))
+	}
+
+	// the deposits claimed by a are skipped by b
+	claimed, err = repo.ClaimDeposits(ctx, "b", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Id != deposits[2].Id {
+		t.Fatalf("b claims %v, want the last deposit", depositIds(claimed))
+	}
+
+	// a takes its own unexpired claims again
+	claimed, err = repo.ClaimDeposits(ctx, "a", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 || claimed[0].Id != deposits[0].Id || claimed[1].Id != deposits[1].Id {
+		t.Fatalf("a claims %v again, want its own claims", depositIds(claimed))
+	}
+}
+
+func TestClaimDeposits_Expiry(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01")
+
+	if _, err := repo.ClaimDeposits(ctx, "a", time.Millisecond*10, 10); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	claimed, err := repo.ClaimDeposits(ctx, "b", time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].Id != deposits[0].Id || claimed[0].ClaimOwner != "b" {
+		t.Fatalf("b claims %v, want the expired claim of a", depositIds(claimed))
+	}
+}
+
+func TestNewDrip_ClaimLost(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	saveTestDeposits(t, repo, "0x01")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Millisecond*10, 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if _, err := repo.ClaimDeposits(ctx, "b", time.Minute, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	deposit := claimed[0]
+	drip := &Drip{Pid: deposit.Id, Txid: "0xabc", From: "0xf0", To: deposit.To, Amount: 0.01, Rawtx: []byte{1}}
+	if err := repo.NewDrip(ctx, deposit, drip); !errors.Is(err, ErrClaimLost) {
+		t.Fatalf("NewDrip() = %v, want ErrClaimLost", err)
+	}
+	if first, err := repo.HasGotDrip(ctx, deposit.To, 0); err != nil || !first {
+		t.Errorf("the drip of a lost claim should be rolled back, HasGotDrip() = %v, %v", first, err)
+	}
+}
+
+func TestNewDrip_Duplicate(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	saveTestDeposits(t, repo, "0x01", "0x01")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 10)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	for i, deposit := range claimed {
+		drip := &Drip{Pid: deposit.Id, Txid: "0xabc" + deposit.Txid[60:], From: "0xf0", To: deposit.To, Amount: 0.01, Rawtx: []byte{1}}
+		err := repo.NewDrip(ctx, deposit, drip)
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 && !errors.Is(err, ErrDuplicateDrip) {
+			t.Fatalf("NewDrip() of the same receiver = %v, want ErrDuplicateDrip", err)
+		}
+	}
+
+	// the deposit is skipped after the duplicate
+	if err := repo.NewDrip(ctx, claimed[1], nil); err != nil {
+		t.Fatal(err)
+	}
+	deposits, err := repo.GetDepositsAfter(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deposits[0].Status != DepositStatusProcessing || deposits[1].Status != DepositStatusIgnore {
+		t.Errorf("statuses = %s %s, want processing ignore", deposits[0].Status, deposits[1].Status)
+	}
+}
+
+func TestGetDripReceivers(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	saveTestDeposits(t, repo, "0x01", "0x02")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 10)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	for _, deposit := range claimed {
+		drip := &Drip{Pid: deposit.Id, Txid: "0xabc" + deposit.Txid[60:], From: "0xf0", To: deposit.To, Amount: 0.01, Rawtx: []byte{1}}
+		if err := repo.NewDrip(ctx, deposit, drip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receivers, err := repo.GetDripReceivers(ctx, claimed[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receivers) != 1 || receivers[0] != "0x01" {
+		t.Errorf("GetDripReceivers() = %v, want [0x01]", receivers)
+	}
+}
+
+func TestGetDripUsage(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	saveTestDeposits(t, repo, "0x01", "0x02")
+
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 10)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	for _, deposit := range claimed {
+		drip := &Drip{Pid: deposit.Id, Txid: "0xabc" + deposit.Txid[60:], From: "0xf0", To: deposit.To, Amount: 0.25, Rawtx: []byte{1}}
+		if err := repo.NewDrip(ctx, deposit, drip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the second drip is stamped two hours ago by the clock of mysql
+	if _, err := repo.db.ExecContext(ctx, "UPDATE `drips` SET `ctime`=NOW()-INTERVAL 2 HOUR WHERE `pid`=?;", claimed[1].Id); err != nil {
+		t.Fatal(err)
+	}
+
+	count, amount, err := repo.GetDripUsage(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || amount != 0.25 {
+		t.Errorf("GetDripUsage(1h) = %d %v, want 1 0.25", count, amount)
+	}
+	if count, amount, err = repo.GetDripUsage(ctx, time.Hour*3); err != nil || count != 2 || amount != 0.5 {
+		t.Errorf("GetDripUsage(3h) = %d %v %v, want 2 0.5", count, amount, err)
+	}
+}
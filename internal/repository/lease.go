@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrFenced is returned by the writes of a fenced repository whose lease is not held anymore
+var ErrFenced = errors.New("lease is not held")
+
+// Fence holds the fencing token of a lease, 0 means the lease is not held
+type Fence struct {
+	role   string
+	holder string
+	token  uint64
+}
+
+func NewFence(role, holder string) *Fence {
+	return &Fence{role: role, holder: holder}
+}
+
+func (f *Fence) Token() uint64 {
+	return atomic.LoadUint64(&f.token)
+}
+
+func (f *Fence) SetToken(token uint64) {
+	atomic.StoreUint64(&f.token, token)
+}
+
+// WithFence returns the repository whose transactions fail with ErrFenced
+// unless the fencing token is still the token of the unexpired lease
+func (m Metis) WithFence(fence *Fence) Metis {
+	m.fence = fence
+	return m
+}
+
+func (m Metis) leaseName(role string) string {
+	return fmt.Sprintf("%s:%d", role, m.chainId)
+}
+
+func (m Metis) checkFence(ctx context.Context, tx *sqlx.Tx) error {
+	if m.fence == nil {
+		return nil
+	}
+	token := m.fence.Token()
+	if token == 0 {
+		return ErrFenced
+	}
+
+	const query = "SELECT `token` FROM `leases` WHERE `name`=? AND `holder`=? AND `token`=? AND `expiry`>NOW(3) LOCK IN SHARE MODE;"
+	var current uint64
+	if err := tx.QueryRowContext(ctx, query, m.leaseName(m.fence.role), m.fence.holder, token).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrFenced
+		}
+		return fmt.Errorf("check fence: %w", err)
+	}
+	return nil
+}
+
+// AcquireLease takes or renews the lease of the role for the ttl and returns its fencing token.
+// The token is increased whenever the lease changes hands, 0 means the lease is held by another holder.
+func (m Metis) AcquireLease(ctx context.Context, role, holder string, ttl time.Duration) (uint64, error) {
+	var name = m.leaseName(role)
+	m.fence = nil
+
+	const init = "INSERT INTO `leases` (`name`,`expiry`) VALUES (?,NOW(3)) ON DUPLICATE KEY UPDATE `name`=`name`;"
+	if _, err := m.db.ExecContext(ctx, init, name); err != nil {
+		return 0, fmt.Errorf("AcquireLease: %w", err)
+	}
+
+	var token uint64
+	err := m.inTx(ctx, "AcquireLease", func(tx *sqlx.Tx) error {
+		const query = "SELECT `holder`,`token`,`expiry`<=NOW(3) FROM `leases` WHERE `name`=? FOR UPDATE;"
+		var current string
+		var expired bool
+		if err := tx.QueryRowContext(ctx, query, name).Scan(&current, &token, &expired); err != nil {
+			return fmt.Errorf("AcquireLease: %w", err)
+		}
+
+		switch {
+		case current == holder:
+		case expired:
+			token++
+		default:
+			token = 0
+			return nil
+		}
+
+		const update = "UPDATE `leases` SET `holder`=?,`token`=?,`expiry`=DATE_ADD(NOW(3),INTERVAL ? MICROSECOND) WHERE `name`=?;"
+		if _, err := tx.ExecContext(ctx, update, holder, token, ttl.Microseconds(), name); err != nil {
+			return fmt.Errorf("AcquireLease: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+// ReleaseLease expires the lease if it's still held with the token, so a standby takes over at once
+func (m Metis) ReleaseLease(ctx context.Context, role, holder string, token uint64) error {
+	const query = "UPDATE `leases` SET `expiry`=NOW(3) WHERE `name`=? AND `holder`=? AND `token`=?;"
+	if _, err := m.db.ExecContext(ctx, query, m.leaseName(role), holder, token); err != nil {
+		return fmt.Errorf("ReleaseLease: %w", err)
+	}
+	return nil
+}
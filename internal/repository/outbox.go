@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithOutbox returns the repository which writes the outbox events given with the changes,
+// to be delivered to the webhook and/or published to the sink
+func (m Metis) WithOutbox(webhooks, sink bool) Metis {
+	m.webhooks, m.sink = webhooks, sink
+	return m
+}
+
+// insertOutboxEvents writes the events, they are born delivered to the consumers which are disabled
+func (m Metis) insertOutboxEvents(ctx context.Context, tx *sqlx.Tx, events []*OutboxEvent) error {
+	if !m.webhooks && !m.sink {
+		return nil
+	}
+	var status = WebhookStatusPending
+	if !m.webhooks {
+		status = WebhookStatusDisabled
+	}
+
+	const query = "INSERT INTO `outbox` (`chain_id`,`event`,`dedup_key`,`payload`,`status`,`published_at`) " +
+		"VALUES (?,?,?,?,?,IF(?,NULL,NOW())) ON DUPLICATE KEY UPDATE `id`=`id`;"
+	for _, item := range events {
+		if _, err := tx.ExecContext(ctx, query, m.chainId, item.Event, item.DedupKey, item.Payload, status, m.sink); err != nil {
+			return fmt.Errorf("insert outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddOutboxEvents stores events which don't come with a change of deposits or drips
+func (m Metis) AddOutboxEvents(ctx context.Context, events ...*OutboxEvent) error {
+	return m.inTx(ctx, "AddOutboxEvents", func(tx *sqlx.Tx) error {
+		if err := m.insertOutboxEvents(ctx, tx, events); err != nil {
+			return fmt.Errorf("AddOutboxEvents: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetUnpublishedOutboxEvents returns the events which are not published yet in the order they are written
+func (m Metis) GetUnpublishedOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	const query = "SELECT * FROM `outbox` WHERE `chain_id`=? AND `published_at` IS NULL ORDER BY `id` LIMIT ?;"
+
+	var events []*OutboxEvent
+	if err := m.db.SelectContext(ctx, &events, query, m.chainId, limit); err != nil {
+		return nil, fmt.Errorf("GetUnpublishedOutboxEvents: %w", err)
+	}
+	return events, nil
+}
+
+func (m Metis) MarkOutboxPublished(ctx context.Context, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("UPDATE `outbox` SET `published_at`=NOW() WHERE `id` IN (?);", ids)
+	if err != nil {
+		return fmt.Errorf("MarkOutboxPublished: %w", err)
+	}
+	return m.inTx(ctx, "MarkOutboxPublished", func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("MarkOutboxPublished: %w", err)
+		}
+		return nil
+	})
+}
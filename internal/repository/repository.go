@@ -2,10 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 )
 
 func Connect(conn string) (*sqlx.DB, error) {
@@ -21,10 +25,59 @@ func Connect(conn string) (*sqlx.DB, error) {
 	return db, nil
 }
 
+// Metis is the repository of a chain, every row it reads or writes belongs to the chain
 type Metis struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	chainId uint64
+	// the outbox events are written if webhooks or the sink are enabled
+	webhooks bool
+	sink     bool
+	fence    *Fence
 }
 
-func NewMetis(db *sqlx.DB) Metis {
-	return Metis{db: db}
+func NewMetis(db *sqlx.DB, chainId uint64) Metis {
+	return Metis{db: db, chainId: chainId}
+}
+
+func (m Metis) ChainId() uint64 {
+	return m.chainId
+}
+
+// inTx runs fn in a transaction which is committed if fn succeeds
+func (m Metis) inTx(ctx context.Context, name string, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin tx %w", name, err)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rollbackError := tx.Rollback(); rollbackError != nil {
+			logrus.Errorf("%s: rollback: %s", name, rollbackError)
+		}
+	}()
+
+	if err = m.checkFence(ctx, tx); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertAuditLog(ctx context.Context, tx *sqlx.Tx, audit *AuditLog) error {
+	const query = "INSERT INTO `audit_logs` (`operator`,`action`,`target`,`detail`) VALUES (?,?,?,?);"
+	if _, err := tx.ExecContext(ctx, query, audit.Operator, audit.Action, audit.Target, audit.Detail); err != nil {
+		return fmt.Errorf("insert audit log: %w", err)
+	}
+	return nil
+}
+
+// isDuplicateKey tells whether the error is a violation of the unique key
+func isDuplicateKey(err error, key string) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, key)
 }
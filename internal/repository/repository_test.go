@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/go-sql-driver/mysql"
+)
+
+// newTestMetis returns the repository of chain 1088 in a new database with the migrations applied.
+// It needs a mysql server given by TEST_MYSQL_DSN, e.g. root:passwd@tcp(127.0.0.1:3306)/, the test is skipped otherwise.
+func newTestMetis(t *testing.T) Metis {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ParseTime, cfg.MultiStatements = true, true
+
+	cfg.DBName = ""
+	admin, err := Connect(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("faucet_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE DATABASE `" + name + "`;"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = admin.Exec("DROP DATABASE `" + name + "`;")
+		admin.Close()
+	})
+
+	cfg.DBName = name
+	db, err := Connect(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(data)); err != nil {
+			t.Fatalf("%s: %s", filepath.Base(path), err)
+		}
+	}
+
+	return NewMetis(db, 1088)
+}
+
+// saveTestDeposits stores unprocessed deposits to the receivers and returns them in the order of their ids
+func saveTestDeposits(t *testing.T, repo Metis, receivers ...string) []*Deposit {
+	var deposits []*Deposit
+	for i, to := range receivers {
+		deposits = append(deposits, &Deposit{
+			Height:   uint64(100 + i),
+			Txid:     fmt.Sprintf("0x%064x", i+1),
+			LogIndex: sql.NullInt64{Int64: 0, Valid: true},
+			To:       to,
+			Amount:   bigint.New(1),
+		})
+	}
+	ctx := context.Background()
+	if err := repo.SaveDeposits(ctx, deposits); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := repo.GetDepositsAfter(ctx, 0, len(receivers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != len(receivers) {
+		t.Fatalf("saved %d deposits, want %d", len(saved), len(receivers))
+	}
+	return saved
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	err := fmt.Errorf("save drip: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1088-0xa' for key 'drips.uk_chain_id_to'"})
+	if !isDuplicateKey(err, "uk_chain_id_to") {
+		t.Error("a violation of the key should be a duplicate key")
+	}
+	if isDuplicateKey(err, "pk_pid") {
+		t.Error("a violation of another key should not be a duplicate key")
+	}
+	if isDuplicateKey(errors.New("Duplicate entry for key uk_chain_id_to"), "uk_chain_id_to") {
+		t.Error("only mysql errors should be duplicate keys")
+	}
+}
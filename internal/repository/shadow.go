@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// SaveShadowDrip records the decision of a dry run on the deposit, a deposit evaluated again replaces its record
+func (m Metis) SaveShadowDrip(ctx context.Context, item *ShadowDrip) error {
+	const query = "INSERT INTO `shadow_drips` (`pid`,`chain_id`,`txid`,`from`,`to`,`amount`,`rawtx`,`reason`,`check_mode`) VALUES (?,?,?,?,?,?,?,?,?) " +
+		"ON DUPLICATE KEY UPDATE `txid`=VALUES(`txid`),`from`=VALUES(`from`),`amount`=VALUES(`amount`),`rawtx`=VALUES(`rawtx`)," +
+		"`reason`=VALUES(`reason`),`check_mode`=VALUES(`check_mode`);"
+
+	args := []interface{}{item.Pid, m.chainId, item.Txid, item.From, item.To, item.Amount, item.Rawtx, item.Reason, item.CheckMode}
+	if _, err := m.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("SaveShadowDrip: %w", err)
+	}
+	return nil
+}
+
+// GetShadowCursor returns the id of the last deposit evaluated by the dry run, 0 if there is none
+func (m Metis) GetShadowCursor(ctx context.Context) (uint64, error) {
+	const query = "SELECT COALESCE(MAX(`pid`),0) FROM `shadow_drips` WHERE `chain_id`=?;"
+	var cursor uint64
+	if err := m.db.QueryRowContext(ctx, query, m.chainId).Scan(&cursor); err != nil {
+		return 0, fmt.Errorf("GetShadowCursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// GetDepositsAfter returns the deposits with an id greater than the cursor in the order of id, whatever their status
+func (m Metis) GetDepositsAfter(ctx context.Context, cursor uint64, limit int) ([]*Deposit, error) {
+	const query = "SELECT * FROM `deposits` WHERE `chain_id`=? AND `id`>? ORDER BY `id` LIMIT ?;"
+	var deposits []*Deposit
+	if err := m.db.SelectContext(ctx, &deposits, query, m.chainId, cursor, limit); err != nil {
+		return nil, fmt.Errorf("GetDepositsAfter: %w", err)
+	}
+	return deposits, nil
+}
+
+// GetLastDepositId returns the greatest id of the deposits, 0 if there is none
+func (m Metis) GetLastDepositId(ctx context.Context) (uint64, error) {
+	const query = "SELECT COALESCE(MAX(`id`),0) FROM `deposits` WHERE `chain_id`=?;"
+	var id uint64
+	if err := m.db.QueryRowContext(ctx, query, m.chainId).Scan(&id); err != nil {
+		return 0, fmt.Errorf("GetLastDepositId: %w", err)
+	}
+	return id, nil
+}
+
+// HasGotShadowDrip reports whether the address has got no drip in the dry run,
+// the record of the deposit pid itself is not counted
+func (m Metis) HasGotShadowDrip(ctx context.Context, address string, pid uint64) (bool, error) {
+	const query = "SELECT COUNT(*) FROM `shadow_drips` WHERE `chain_id`=? AND `to`=? AND `pid`<>? AND `txid`<>'';"
+	var count int
+	if err := m.db.QueryRowContext(ctx, query, m.chainId, address, pid).Scan(&count); err != nil {
+		return false, fmt.Errorf("HasGotShadowDrip: %w", err)
+	}
+	return count == 0, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShadowDrips(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01", "0x01", "0x02")
+
+	if id, err := repo.GetLastDepositId(ctx); err != nil || id != deposits[2].Id {
+		t.Fatalf("GetLastDepositId() = %d, %v, want %d", id, err, deposits[2].Id)
+	}
+
+	// the dry run drips to the first deposit and skips the third
+	if err := repo.SaveShadowDrip(ctx, &ShadowDrip{Pid: deposits[0].Id, Txid: "0xabc", To: "0x01", Amount: 0.01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveShadowDrip(ctx, &ShadowDrip{Pid: deposits[2].Id, To: "0x02", Reason: "nonce > 0"}); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, err := repo.GetShadowCursor(ctx); err != nil || cursor != deposits[2].Id {
+		t.Fatalf("GetShadowCursor() = %d, %v, want %d", cursor, err, deposits[2].Id)
+	}
+
+	tests := []struct {
+		to   string
+		pid  uint64
+		want bool
+	}{
+		{"0x01", deposits[1].Id, false},
+		{"0x01", deposits[0].Id, true},
+		{"0x02", 0, true},
+	}
+	for _, tt := range tests {
+		if first, err := repo.HasGotShadowDrip(ctx, tt.to, tt.pid); err != nil || first != tt.want {
+			t.Errorf("HasGotShadowDrip(%s, %d) = %v, %v, want %v", tt.to, tt.pid, first, err, tt.want)
+		}
+	}
+}
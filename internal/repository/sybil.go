@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CountDripsByFrom counts drips given within the duration to recipients bridged by the L1 sender,
+// the window is computed by the clock of mysql as in GetDripUsage
+func (m Metis) CountDripsByFrom(ctx context.Context, from string, within time.Duration) (int, error) {
+	const query = "SELECT COUNT(*) FROM `drips` AS B INNER JOIN `deposits` AS A ON A.id=B.pid WHERE A.`chain_id`=? AND A.`from`=? AND B.`ctime`>=NOW()-INTERVAL ? SECOND;"
+	var count int
+	if err := m.db.QueryRowContext(ctx, query, m.chainId, from, seconds(within)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("CountDripsByFrom: %w", err)
+	}
+	return count, nil
+}
+
+// GetFundingClusters lists L1 senders which have bridged to at least minRecipients distinct L2 recipients within the duration
+func (m Metis) GetFundingClusters(ctx context.Context, within time.Duration, minRecipients, limit int) ([]*FundingCluster, error) {
+	const query = "SELECT A.`from` AS `from`,COUNT(DISTINCT A.`to`) AS `recipients`,COUNT(B.pid) AS `drips`," +
+		"MIN(A.ctime) AS `first_seen`,MAX(A.ctime) AS `last_seen` " +
+		"FROM `deposits` AS A LEFT JOIN `drips` AS B ON A.id=B.pid WHERE A.`chain_id`=? AND A.`ctime`>=NOW()-INTERVAL ? SECOND " +
+		"GROUP BY A.`from` HAVING `recipients`>=? ORDER BY `recipients` DESC LIMIT ?;"
+
+	var clusters []*FundingCluster
+	if err := m.db.SelectContext(ctx, &clusters, query, m.chainId, seconds(within), minRecipients, limit); err != nil {
+		return nil, fmt.Errorf("GetFundingClusters: %w", err)
+	}
+	return clusters, nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCountDripsByFrom(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01", "0x02", "0x03", "0x04")
+
+	// the first 3 deposits are bridged by 0xa1, the last one by 0xa2
+	for i, item := range deposits {
+		from := "0xa1"
+		if i == 3 {
+			from = "0xa2"
+		}
+		if _, err := repo.db.ExecContext(ctx, "UPDATE `deposits` SET `from`=? WHERE `id`=?;", from, item.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 10)
+	if err != nil || len(claimed) != 4 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	for _, deposit := range claimed {
+		drip := &Drip{Pid: deposit.Id, Txid: "0xabc" + deposit.Txid[60:], From: "0xf0", To: deposit.To, Amount: 0.01, Rawtx: []byte{1}}
+		if err := repo.NewDrip(ctx, deposit, drip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.db.ExecContext(ctx, "UPDATE `drips` SET `ctime`=NOW()-INTERVAL 2 HOUR WHERE `pid`=?;", claimed[0].Id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from   string
+		within time.Duration
+		want   int
+	}{
+		{"0xa1", time.Hour, 2},
+		{"0xa1", time.Hour * 3, 3},
+		{"0xa2", time.Hour, 1},
+		{"0xa3", time.Hour, 0},
+	}
+	for _, tt := range tests {
+		count, err := repo.CountDripsByFrom(ctx, tt.from, tt.within)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != tt.want {
+			t.Errorf("CountDripsByFrom(%s, %s) = %d, want %d", tt.from, tt.within, count, tt.want)
+		}
+	}
+}
+
+func TestGetFundingClusters(t *testing.T) {
+	repo := newTestMetis(t)
+	ctx := context.Background()
+	deposits := saveTestDeposits(t, repo, "0x01", "0x02", "0x02", "0x03", "0x04")
+
+	// 0xa1 funds 3 distinct recipients in 4 deposits, 0xa2 funds one
+	for i, item := range deposits {
+		from := "0xa1"
+		if i == 4 {
+			from = "0xa2"
+		}
+		if _, err := repo.db.ExecContext(ctx, "UPDATE `deposits` SET `from`=? WHERE `id`=?;", from, item.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	claimed, err := repo.ClaimDeposits(ctx, "a", time.Minute, 1)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("a claims %d deposits: %v", len(claimed), err)
+	}
+	drip := &Drip{Pid: claimed[0].Id, Txid: "0xabc", From: "0xf0", To: claimed[0].To, Amount: 0.01, Rawtx: []byte{1}}
+	if err := repo.NewDrip(ctx, claimed[0], drip); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := repo.GetFundingClusters(ctx, time.Hour, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || clusters[0].From != "0xa1" || clusters[0].Recipients != 3 || clusters[0].Drips != 1 {
+		t.Fatalf("GetFundingClusters() = %+v, want 0xa1 with 3 recipients and 1 drip", clusters)
+	}
+
+	// the deposits out of the window are not counted
+	if _, err := repo.db.ExecContext(ctx, "UPDATE `deposits` SET `ctime`=NOW()-INTERVAL 2 HOUR;"); err != nil {
+		t.Fatal(err)
+	}
+	if clusters, err = repo.GetFundingClusters(ctx, time.Hour, 2, 10); err != nil || len(clusters) != 0 {
+		t.Errorf("GetFundingClusters() = %d clusters %v, want none in the window", len(clusters), err)
+	}
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GetToken returns the metadata of the L2 token, or nil if it has not been saved
+func (m Metis) GetToken(ctx context.Context, address string) (*Token, error) {
+	const query = "SELECT * FROM `tokens` WHERE `chain_id`=? AND `address`=?;"
+
+	var token Token
+	if err := m.db.QueryRowxContext(ctx, query, m.chainId, strings.ToLower(address)).StructScan(&token); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetToken: %w", err)
+	}
+	return &token, nil
+}
+
+func (m Metis) SaveToken(ctx context.Context, token *Token) error {
+	const query = "INSERT INTO `tokens` (`chain_id`,`address`,`l1token`,`name`,`symbol`,`decimals`,`standard`,`checked_at`) VALUES (?,?,?,?,?,?,?,?) " +
+		"ON DUPLICATE KEY UPDATE `l1token`=VALUES(`l1token`),`name`=VALUES(`name`),`symbol`=VALUES(`symbol`)," +
+		"`decimals`=VALUES(`decimals`),`standard`=VALUES(`standard`),`checked_at`=VALUES(`checked_at`);"
+
+	args := []interface{}{m.chainId, strings.ToLower(token.Address), strings.ToLower(token.L1Token), token.Name, token.Symbol, token.Decimals, token.Standard, token.CheckedAt}
+	if _, err := m.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("SaveToken: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetDueWebhookEvents returns the events pending a webhook delivery whose next attempt is due, oldest first
+func (m Metis) GetDueWebhookEvents(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	const query = "SELECT * FROM `outbox` WHERE `chain_id`=? AND `status`=? AND `next_at`<=NOW() ORDER BY `id` LIMIT ?;"
+
+	var events []*OutboxEvent
+	if err := m.db.SelectContext(ctx, &events, query, m.chainId, WebhookStatusPending, limit); err != nil {
+		return nil, fmt.Errorf("GetDueWebhookEvents: %w", err)
+	}
+	return events, nil
+}
+
+func (m Metis) WebhookDelivered(ctx context.Context, id uint64) error {
+	const query = "UPDATE `outbox` SET `status`=?,`attempts`=`attempts`+1,`last_error`='' WHERE `id`=?;"
+	return m.inTx(ctx, "WebhookDelivered", func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, WebhookStatusDelivered, id); err != nil {
+			return fmt.Errorf("WebhookDelivered: %w", err)
+		}
+		return nil
+	})
+}
+
+// WebhookAttemptFailed schedules the next attempt after the delay, or gives the event up
+func (m Metis) WebhookAttemptFailed(ctx context.Context, id uint64, lastError string, delay time.Duration, giveUp bool) error {
+	var status = WebhookStatusPending
+	if giveUp {
+		status = WebhookStatusFailed
+	}
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+
+	const query = "UPDATE `outbox` SET `status`=?,`attempts`=`attempts`+1,`last_error`=?," +
+		"`next_at`=DATE_ADD(NOW(),INTERVAL ? SECOND) WHERE `id`=?;"
+	return m.inTx(ctx, "WebhookAttemptFailed", func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, status, lastError, int64(delay/time.Second), id); err != nil {
+			return fmt.Errorf("WebhookAttemptFailed: %w", err)
+		}
+		return nil
+	})
+}
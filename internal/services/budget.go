@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Budget caps how much the faucet spends, zero values mean no limit
+type Budget struct {
+	MaxDripsPerHour int     `json:"maxDripsPerHour"`
+	MaxMetisPerDay  float64 `json:"maxMetisPerDay"`
+}
+
+// BudgetStatus is the usage of the budget in the current hour and day windows (UTC)
+type BudgetStatus struct {
+	Budget
+	HourlyDrips int       `json:"hourlyDrips"`
+	DailyMetis  float64   `json:"dailyMetis"`
+	HourResetAt time.Time `json:"hourResetAt"`
+	DayResetAt  time.Time `json:"dayResetAt"`
+}
+
+// float64 sums of decimal amounts are not exact
+const metisEpsilon = 1e-9
+
+func newBudgetStatus(budget Budget, now time.Time) *BudgetStatus {
+	now = now.UTC()
+	return &BudgetStatus{
+		Budget:      budget,
+		HourResetAt: now.Truncate(time.Hour).Add(time.Hour),
+		DayResetAt:  now.Truncate(time.Hour * 24).Add(time.Hour * 24),
+	}
+}
+
+// Allows reports whether a drip of the amount fits into the remaining budget
+func (b *BudgetStatus) Allows(amount float64) bool {
+	if b.MaxDripsPerHour > 0 && b.HourlyDrips >= b.MaxDripsPerHour {
+		return false
+	}
+	if b.MaxMetisPerDay > 0 && b.DailyMetis+amount > b.MaxMetisPerDay+metisEpsilon {
+		return false
+	}
+	return true
+}
+
+func (b *BudgetStatus) Spend(amount float64) {
+	b.HourlyDrips++
+	b.DailyMetis += amount
+}
+
+// ResetAt returns when the exhausted window ends
+func (b *BudgetStatus) ResetAt() time.Time {
+	if b.MaxDripsPerHour > 0 && b.HourlyDrips >= b.MaxDripsPerHour {
+		return b.HourResetAt
+	}
+	return b.DayResetAt
+}
+
+// RemainingDrips returns -1 if there is no hourly limit
+func (b *BudgetStatus) RemainingDrips() int {
+	if b.MaxDripsPerHour <= 0 {
+		return -1
+	}
+	if remaining := b.MaxDripsPerHour - b.HourlyDrips; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// RemainingMetis returns -1 if there is no daily limit
+func (b *BudgetStatus) RemainingMetis() float64 {
+	if b.MaxMetisPerDay <= 0 {
+		return -1
+	}
+	if remaining := b.MaxMetisPerDay - b.DailyMetis; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// BudgetStatus loads the usage of the current windows from the drips table,
+// the windows are passed as the time elapsed since they began, the drips are stamped by the clock of mysql
+func (s *Faucet) BudgetStatus(basectx context.Context) (*BudgetStatus, error) {
+	newctx, cancel := context.WithTimeout(basectx, time.Second*5)
+	defer cancel()
+
+	now := time.Now()
+	status := newBudgetStatus(s.Budget, now)
+	if s.Budget.MaxDripsPerHour > 0 {
+		count, _, err := s.Repositroy.GetDripUsage(newctx, now.Sub(status.HourResetAt.Add(-time.Hour)))
+		if err != nil {
+			return nil, err
+		}
+		status.HourlyDrips = count
+	}
+	if s.Budget.MaxMetisPerDay > 0 {
+		_, amount, err := s.Repositroy.GetDripUsage(newctx, now.Sub(status.DayResetAt.Add(-time.Hour*24)))
+		if err != nil {
+			return nil, err
+		}
+		status.DailyMetis = amount
+	}
+	return status, nil
+}
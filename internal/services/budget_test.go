@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+func TestBudgetStatus_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		status BudgetStatus
+		amount float64
+		want   bool
+	}{
+		{"no limit", BudgetStatus{HourlyDrips: 1000, DailyMetis: 1000}, 0.01, true},
+		{"hourly drips left", BudgetStatus{Budget: Budget{MaxDripsPerHour: 10}, HourlyDrips: 9}, 0.01, true},
+		{"hourly drips exhausted", BudgetStatus{Budget: Budget{MaxDripsPerHour: 10}, HourlyDrips: 10}, 0.01, false},
+		{"daily metis left", BudgetStatus{Budget: Budget{MaxMetisPerDay: 1}, DailyMetis: 0.99}, 0.01, true},
+		{"daily metis exhausted", BudgetStatus{Budget: Budget{MaxMetisPerDay: 1}, DailyMetis: 0.995}, 0.01, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.Allows(tt.amount); got != tt.want {
+				t.Errorf("BudgetStatus.Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetStatus_Spend(t *testing.T) {
+	status := newBudgetStatus(Budget{MaxDripsPerHour: 200, MaxMetisPerDay: 1}, time.Now())
+	var count int
+	for status.Allows(0.01) {
+		status.Spend(0.01)
+		count++
+	}
+	if count != 100 {
+		t.Errorf("BudgetStatus.Spend() allowed %d drips, want 100", count)
+	}
+	if got := status.RemainingMetis(); got != 0 {
+		t.Errorf("BudgetStatus.RemainingMetis() = %v, want 0", got)
+	}
+	if got := status.RemainingDrips(); got != 100 {
+		t.Errorf("BudgetStatus.RemainingDrips() = %v, want 100", got)
+	}
+	if got := status.ResetAt(); !got.Equal(status.DayResetAt) {
+		t.Errorf("BudgetStatus.ResetAt() = %v, want %v", got, status.DayResetAt)
+	}
+}
+
+func TestNewBudgetStatus(t *testing.T) {
+	now := time.Date(2022, 1, 25, 13, 45, 10, 0, time.UTC)
+	status := newBudgetStatus(Budget{}, now)
+	if want := time.Date(2022, 1, 25, 14, 0, 0, 0, time.UTC); !status.HourResetAt.Equal(want) {
+		t.Errorf("HourResetAt = %v, want %v", status.HourResetAt, want)
+	}
+	if want := time.Date(2022, 1, 26, 0, 0, 0, 0, time.UTC); !status.DayResetAt.Equal(want) {
+		t.Errorf("DayResetAt = %v, want %v", status.DayResetAt, want)
+	}
+}
+
+func TestFaucet_BudgetStatus(t *testing.T) {
+	repo := &fakeRepository{}
+	faucet := newTestFaucet(&fakeWeb3{}, repo)
+	faucet.Budget = Budget{MaxDripsPerHour: 10, MaxMetisPerDay: 1}
+
+	now := time.Now().UTC()
+	hourStart, dayStart := now.Truncate(time.Hour), now.Truncate(time.Hour*24)
+	repo.drips = []*repository.Drip{
+		{To: "0x01", Amount: 0.1, CreatedAt: now},
+		{To: "0x02", Amount: 0.2, CreatedAt: hourStart.Add(-time.Second)},
+		{To: "0x03", Amount: 0.4, CreatedAt: dayStart.Add(-time.Second)},
+	}
+
+	status, err := faucet.BudgetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second drip is in the daily window unless the hour is the first of the day
+	wantMetis := 0.3
+	if hourStart.Equal(dayStart) {
+		wantMetis = 0.1
+	}
+	if status.HourlyDrips != 1 || math.Abs(status.DailyMetis-wantMetis) > metisEpsilon {
+		t.Errorf("BudgetStatus() = %d drips %v metis, want 1 drips %v metis", status.HourlyDrips, status.DailyMetis, wantMetis)
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"math/big"
@@ -13,21 +14,45 @@ import (
 	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
 	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 )
 
+// SyncRepository is the part of repository.Metis used by the syncer
+type SyncRepository interface {
+	InitHeight(ctx context.Context) (uint64, error)
+	SaveSyncedData(ctx context.Context, deposits []*repository.Deposit, tail *repository.Height, events ...*repository.OutboxEvent) error
+	SaveDeposits(ctx context.Context, deposits []*repository.Deposit, events ...*repository.OutboxEvent) error
+	SaveReindexedDeposits(ctx context.Context, deposits []*repository.Deposit) (int, []string, error)
+}
+
 type DataSync struct {
-	Web3Client *ethclient.Client
+	Network    *utils.Network
+	Web3Client Web3Client
 	Bridge     *metisl2.L2StandardBridge
-	Repositroy repository.Metis
+	Repositroy SyncRepository
 	RangeSync  uint64
 	DripHeight uint64
 
+	// MaxRangeSync caps the adaptive range, which starts from RangeSync
+	MaxRangeSync uint64
+	// CatchUpRange and CatchUpWorkers are used to fetch ranges concurrently when far behind the head,
+	// catching up is disabled if CatchUpWorkers is less than 2
+	CatchUpRange   uint64
+	CatchUpWorkers int
+
+	// NewDeposits is signaled without blocking after unprocessed deposits are committed
+	NewDeposits chan<- struct{}
+
 	height uint64
+	ranger *adaptiveRange
+	health loopHealth
 }
 
 func (s *DataSync) Prefight(basectx context.Context) (err error) {
+	s.ranger = newAdaptiveRange(s.RangeSync, s.MaxRangeSync)
+
 	newctx, cancel := context.WithTimeout(basectx, time.Second*5)
 	defer cancel()
 	s.height, err = s.Repositroy.InitHeight(newctx)
@@ -52,71 +77,180 @@ func (s *DataSync) tryToSync(basectx context.Context) error {
 	if err != nil {
 		return err
 	}
+	return s.syncTo(basectx, latestBlock)
+}
 
-	for targetHeight := latestBlock; s.height < targetHeight; {
-		startHeight, endHeight := s.height, s.height+s.RangeSync
+func (s *DataSync) syncTo(basectx context.Context, targetHeight uint64) (err error) {
+	defer func() { s.health.record(err) }()
+
+	for s.height < targetHeight {
+		if s.CatchUpWorkers > 1 && s.CatchUpRange > 0 && targetHeight-s.height > s.CatchUpRange*uint64(s.CatchUpWorkers) {
+			if err := s.catchUp(basectx, targetHeight); err != nil {
+				return err
+			}
+			continue
+		}
+
+		startHeight, endHeight := s.height, s.height+s.ranger.size
 		if endHeight > targetHeight {
 			endHeight = targetHeight
 		}
+
+		begin := time.Now()
 		if err := s.syncWithRange(basectx, startHeight, endHeight); err != nil {
+			if isRangeTooLarge(err) && s.ranger.shrink(err) {
+				logrus.Warnf("Shrinking range to %d: %s", s.ranger.size, err)
+				continue
+			}
 			return err
 		}
+		s.ranger.succeed(time.Since(begin))
 		s.height = endHeight + 1
+		s.health.record(nil)
 	}
 	return nil
 }
 
+// catchUp fetches several large ranges concurrently and commits them in order
+func (s *DataSync) catchUp(basectx context.Context, targetHeight uint64) error {
+	var ranges []*syncedRange
+	for startHeight := s.height; len(ranges) < s.CatchUpWorkers && startHeight < targetHeight; {
+		endHeight := startHeight + s.CatchUpRange
+		if endHeight > targetHeight {
+			endHeight = targetHeight
+		}
+		ranges = append(ranges, &syncedRange{start: startHeight, end: endHeight})
+		startHeight = endHeight + 1
+	}
+
+	eg, egctx := errgroup.WithContext(basectx)
+	for _, item := range ranges {
+		item := item
+		eg.Go(func() error {
+			return s.fetchRange(egctx, item)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		if isRangeTooLarge(err) && s.CatchUpRange/2 > s.ranger.max {
+			s.CatchUpRange /= 2
+			logrus.Warnf("Shrinking catch up range to %d: %s", s.CatchUpRange, err)
+			return nil
+		}
+		// only the node rejecting the range or timing out on it disables catch up, rate limits are retried
+		if isRangeTooLarge(err) {
+			s.CatchUpWorkers = 0
+			logrus.Warnf("Disabling catch up: %s", err)
+			return nil
+		}
+		return err
+	}
+
+	for _, item := range ranges {
+		if err := s.saveRange(basectx, item); err != nil {
+			return err
+		}
+		s.height = item.end + 1
+		s.health.record(nil)
+	}
+	return nil
+}
+
+type syncedRange struct {
+	start, end uint64
+	header     *types.Header
+	deposits   []*repository.Deposit
+}
+
 func (s *DataSync) syncWithRange(basectx context.Context, startHeight, endHeight uint64) error {
-	logrus.Infof("Syncing from %d to %d", startHeight, endHeight)
+	var item = &syncedRange{start: startHeight, end: endHeight}
+	if err := s.fetchRange(basectx, item); err != nil {
+		return err
+	}
+	return s.saveRange(basectx, item)
+}
+
+func (s *DataSync) fetchRange(basectx context.Context, item *syncedRange) (err error) {
+	logrus.Infof("Syncing from %d to %d", item.start, item.end)
 
 	newctx, cancel := context.WithTimeout(basectx, time.Minute)
 	defer cancel()
 
-	formatEvent := func(event *metisl2.L2StandardBridgeDepositFinalized) *repository.Deposit {
-		var status = repository.DepositStatusUnprocessed
-
-		var l2token = strings.ToLower(event.L2Token.Hex())
-		if s.DripHeight > event.Raw.BlockNumber || l2token == utils.MetisL2Address {
-			status = repository.DepositStatusIgnore
-		}
-
-		return &repository.Deposit{
-			Height:  event.Raw.BlockNumber,
-			Txid:    event.Raw.TxHash.Hex(),
-			L1Token: strings.ToLower(event.L1Token.Hex()),
-			L2Token: l2token,
-			From:    strings.ToLower(event.From.Hex()),
-			To:      strings.ToLower(event.To.Hex()),
-			Amount:  bigint.FromBigInt(event.Amount),
-			Status:  status,
-		}
+	item.header, err = s.Web3Client.HeaderByNumber(newctx, new(big.Int).SetUint64(item.end))
+	if err != nil {
+		return fmt.Errorf("fetchRange: get tail header: %w", err)
 	}
 
-	header, err := s.Web3Client.HeaderByNumber(newctx, big.NewInt(int64(endHeight)))
+	item.deposits, err = s.fetchDeposits(newctx, item.start, item.end)
 	if err != nil {
-		return fmt.Errorf("syncWithRange: get tail header: %w", err)
+		return fmt.Errorf("fetchRange: %w", err)
 	}
-	var tail = &repository.Height{Number: endHeight, Blockhash: header.Hash().String()}
+	return nil
+}
 
-	iter, err := s.Bridge.FilterDepositFinalized(&bind.FilterOpts{Context: newctx, Start: startHeight, End: &endHeight}, nil, nil, nil)
+func (s *DataSync) saveRange(basectx context.Context, item *syncedRange) error {
+	newctx, cancel := context.WithTimeout(basectx, time.Minute)
+	defer cancel()
+
+	var tail = &repository.Height{Number: item.end, Blockhash: item.header.Hash().String()}
+	if err := s.Repositroy.SaveSyncedData(newctx, item.deposits, tail, depositsIndexed(item.deposits)...); err != nil {
+		return fmt.Errorf("saveRange: %w", err)
+	}
+	s.notify(item.deposits)
+
+	logrus.Infof("Done: NewDeposits %d BlockTime %s", len(item.deposits), time.Unix(int64(item.header.Time), 0))
+	return nil
+}
+
+func (s *DataSync) fetchDeposits(ctx context.Context, startHeight, endHeight uint64) ([]*repository.Deposit, error) {
+	iter, err := s.Bridge.FilterDepositFinalized(&bind.FilterOpts{Context: ctx, Start: startHeight, End: &endHeight}, nil, nil, nil)
 	if err != nil {
-		return fmt.Errorf("syncWithRange: filter deposit event: %w", err)
+		return nil, fmt.Errorf("filter deposit event: %w", err)
 	}
 	defer iter.Close()
 
 	var deposits []*repository.Deposit
 	for iter.Next() {
-		deposits = append(deposits, formatEvent(iter.Event))
+		deposits = append(deposits, s.formatEvent(iter.Event))
 	}
 
 	if err := iter.Error(); err != nil {
-		return fmt.Errorf("syncWithRange: filter deposit event: %w", err)
+		return nil, fmt.Errorf("filter deposit event: %w", err)
 	}
+	return deposits, nil
+}
+
+func (s *DataSync) formatEvent(event *metisl2.L2StandardBridgeDepositFinalized) *repository.Deposit {
+	var status = repository.DepositStatusUnprocessed
 
-	if err := s.Repositroy.SaveSyncedData(newctx, deposits, tail); err != nil {
-		return fmt.Errorf("syncWithRange: %w", err)
+	var l2token = strings.ToLower(event.L2Token.Hex())
+	if s.DripHeight > event.Raw.BlockNumber || l2token == s.Network.MetisL2Address {
+		status = repository.DepositStatusIgnore
 	}
 
-	logrus.Infof("Done: NewDeposits %d BlockTime %s", len(deposits), time.Unix(int64(header.Time), 0))
-	return nil
+	return &repository.Deposit{
+		Height:   event.Raw.BlockNumber,
+		Txid:     event.Raw.TxHash.Hex(),
+		LogIndex: sql.NullInt64{Int64: int64(event.Raw.Index), Valid: true},
+		L1Token:  strings.ToLower(event.L1Token.Hex()),
+		L2Token:  l2token,
+		From:     strings.ToLower(event.From.Hex()),
+		To:       strings.ToLower(event.To.Hex()),
+		Amount:   bigint.FromBigInt(event.Amount),
+		Status:   status,
+	}
+}
+
+func (s *DataSync) notify(deposits []*repository.Deposit) {
+	if s.NewDeposits == nil {
+		return
+	}
+	for _, item := range deposits {
+		if item.Status == repository.DepositStatusUnprocessed {
+			select {
+			case s.NewDeposits <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
 }
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// timeoutWeb3 times out on every header, it records the end of the requested ranges
+type timeoutWeb3 struct {
+	fakeWeb3
+	ends []uint64
+}
+
+func (f *timeoutWeb3) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	f.ends = append(f.ends, number.Uint64())
+	return nil, fmt.Errorf("post: %w", context.DeadlineExceeded)
+}
+
+func TestDataSync_ShrinkOnTimeout(t *testing.T) {
+	client := &timeoutWeb3{}
+	s := &DataSync{Web3Client: client, RangeSync: 20, MaxRangeSync: 5000}
+	s.ranger = newAdaptiveRange(s.RangeSync, s.MaxRangeSync)
+	s.ranger.size = 160
+
+	err := s.syncTo(context.Background(), 1000)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("syncTo() = %v, want the timeout once the range can't shrink", err)
+	}
+	want := []uint64{160, 80, 40, 20}
+	if fmt.Sprint(client.ends) != fmt.Sprint(want) {
+		t.Errorf("range ends = %v, want %v", client.ends, want)
+	}
+	if s.height != 0 || s.ranger.size != s.RangeSync {
+		t.Errorf("height = %d, size = %d, want 0 and %d", s.height, s.ranger.size, s.RangeSync)
+	}
+}
+
+// logsWeb3 serves the logs in the filtered block range
+type logsWeb3 struct {
+	fakeWeb3
+	logs []types.Log
+}
+
+func (f *logsWeb3) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, item := range f.logs {
+		if item.BlockNumber >= query.FromBlock.Uint64() && item.BlockNumber <= query.ToBlock.Uint64() {
+			logs = append(logs, item)
+		}
+	}
+	return logs, nil
+}
+
+func (f *logsWeb3) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not implemented")
+}
+
+// newDepositLog returns a DepositFinalized log of the bridge
+func newDepositLog(t *testing.T, height uint64, txid common.Hash, index uint, to common.Address) types.Log {
+	parsed, err := abi.JSON(strings.NewReader(metisl2.L2StandardBridgeMetaData.ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := parsed.Events["DepositFinalized"]
+	data, err := event.Inputs.NonIndexed().Pack(to, big.NewInt(1e18), []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	topics := []common.Hash{event.ID, common.HexToHash(testL1Token), common.HexToHash(testL2Token), common.HexToHash("0xf1")}
+	return types.Log{BlockNumber: height, TxHash: txid, Index: index, Topics: topics, Data: data}
+}
+
+// fakeSyncRepository stores the deposits once by txid and log index, it doesn't move the cursor
+type fakeSyncRepository struct {
+	SyncRepository
+
+	deposits map[string]*repository.Deposit
+	synced   int
+}
+
+func (f *fakeSyncRepository) SaveSyncedData(ctx context.Context, deposits []*repository.Deposit, tail *repository.Height, events ...*repository.OutboxEvent) error {
+	f.synced++
+	return nil
+}
+
+func (f *fakeSyncRepository) SaveReindexedDeposits(ctx context.Context, deposits []*repository.Deposit) (int, []string, error) {
+	if f.deposits == nil {
+		f.deposits = make(map[string]*repository.Deposit)
+	}
+	var inserted int
+	for _, item := range deposits {
+		key := fmt.Sprintf("%s:%d", item.Txid, item.LogIndex.Int64)
+		if _, ok := f.deposits[key]; !ok {
+			f.deposits[key] = item
+			inserted++
+		}
+	}
+	return inserted, nil, nil
+}
+
+func TestDataSync_ReindexTwice(t *testing.T) {
+	client := &logsWeb3{logs: []types.Log{
+		newDepositLog(t, 10, common.HexToHash("0x01"), 0, common.HexToAddress("0x02")),
+		newDepositLog(t, 10, common.HexToHash("0x01"), 1, common.HexToAddress("0x03")),
+		newDepositLog(t, 45, common.HexToHash("0x04"), 0, common.HexToAddress("0x05")),
+	}}
+	bridge, err := metisl2.NewL2StandardBridge(common.HexToAddress("0x4200000000000000000000000000000000000010"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &fakeSyncRepository{}
+	s := &DataSync{Network: &utils.Network{}, Web3Client: client, Bridge: bridge, Repositroy: repo, RangeSync: 20}
+	s.height = 7
+
+	for i := 0; i < 2; i++ {
+		if err := s.Reindex(context.Background(), 0, 50); err != nil {
+			t.Fatal(err)
+		}
+		if len(repo.deposits) != 3 {
+			t.Fatalf("%d deposits after reindexing %d times, want 3", len(repo.deposits), i+1)
+		}
+	}
+	for key, item := range repo.deposits {
+		if item.Status != repository.DepositStatusIgnore {
+			t.Errorf("deposit %s is %s, want ignore so that it gets no drip", key, item.Status)
+		}
+	}
+	if repo.synced != 0 || s.height != 7 {
+		t.Errorf("synced %d times, height %d, want the live cursor untouched", repo.synced, s.height)
+	}
+}
+
+func TestDataSync_Notify(t *testing.T) {
+	notify := make(chan struct{}, 1)
+	s := &DataSync{NewDeposits: notify}
+
+	// the ignored deposits get no drips, so the faucet is not woken up
+	s.notify([]*repository.Deposit{{Status: repository.DepositStatusIgnore}})
+	if len(notify) != 0 {
+		t.Fatal("ignored deposits should not be notified")
+	}
+
+	// the notifications are coalesced without blocking while the faucet is busy
+	for i := 0; i < 3; i++ {
+		s.notify([]*repository.Deposit{{Status: repository.DepositStatusIgnore}, {Status: repository.DepositStatusUnprocessed}})
+	}
+	if len(notify) != 1 {
+		t.Errorf("%d notifications pending, want 1", len(notify))
+	}
+
+	// a syncer without a faucet has no channel
+	s.NewDeposits = nil
+	s.notify([]*repository.Deposit{{Status: repository.DepositStatusUnprocessed}})
+}
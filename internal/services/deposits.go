@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/sirupsen/logrus"
+)
+
+// DepositView is a deposit with the symbol and the human-readable amount of its token
+type DepositView struct {
+	Id             uint64     `json:"id"`
+	Txid           string     `json:"txid"`
+	Height         uint64     `json:"height"`
+	L1Token        string     `json:"l1token"`
+	L2Token        string     `json:"l2token"`
+	Symbol         string     `json:"symbol"`
+	From           string     `json:"from"`
+	To             string     `json:"to"`
+	Amount         bigint.Int `json:"amount"`
+	ReadableAmount float64    `json:"readableAmount"`
+	Status         string     `json:"status"`
+	CheckMode      string     `json:"checkMode,omitempty"`
+}
+
+type Deposits struct {
+	Repositroy repository.Metis
+	Tokens     *Tokens
+}
+
+// List returns the latest deposits matching the filter, the token fields are left empty
+// if the metadata of the token can't be loaded
+func (d *Deposits) List(ctx context.Context, filter repository.DepositFilter) ([]*DepositView, error) {
+	deposits, err := d.Repositroy.GetDeposits(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var views = make([]*DepositView, 0, len(deposits))
+	for _, item := range deposits {
+		view := &DepositView{
+			Id:      item.Id,
+			Txid:    item.Txid,
+			Height:  item.Height,
+			L1Token: item.L1Token,
+			L2Token: item.L2Token,
+			From:    item.From,
+			To:      item.To,
+			Amount:  item.Amount,
+			Status:  item.Status.String(),
+
+			CheckMode: item.CheckMode,
+		}
+		if token, err := d.Tokens.Get(ctx, item.L2Token); err != nil {
+			logrus.Warnf("Unable to load token %s: %s", item.L2Token, err)
+		} else {
+			view.Symbol, view.ReadableAmount = token.Symbol, item.Amount.Readable(int64(token.Decimals))
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
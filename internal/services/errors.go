@@ -1,9 +1,19 @@
 package services
 
+// ErrorNoNeedToTransfer is the reason to skip a deposit, reason is the msg without its details if they vary
 type ErrorNoNeedToTransfer struct {
-	msg string
+	msg    string
+	reason string
 }
 
 func (e ErrorNoNeedToTransfer) Error() string {
 	return e.msg
 }
+
+// Reason groups the skipped deposits, e.g. in the simulation report
+func (e ErrorNoNeedToTransfer) Reason() string {
+	if e.reason != "" {
+		return e.reason
+	}
+	return e.msg
+}
@@ -2,78 +2,260 @@ package services
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
-	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
 	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
 	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/sirupsen/logrus"
 )
 
+// FaucetRepository is the part of repository.Metis used by the faucet
+type FaucetRepository interface {
+	TokenRepository
+
+	ClaimDeposits(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*repository.Deposit, error)
+	GetDepositsAfter(ctx context.Context, cursor uint64, limit int) ([]*repository.Deposit, error)
+	GetAddressListEntry(ctx context.Context, address string) (*repository.AddressListEntry, error)
+	HasGotDrip(ctx context.Context, address string, pid uint64) (bool, error)
+	HasGotShadowDrip(ctx context.Context, address string, pid uint64) (bool, error)
+	CountDripsByFrom(ctx context.Context, from string, within time.Duration) (int, error)
+	GetDripUsage(ctx context.Context, within time.Duration) (int, float64, error)
+	NewDrip(ctx context.Context, deposit *repository.Deposit, drip *repository.Drip, events ...*repository.OutboxEvent) error
+	GetPendingDripsStream(ctx context.Context) <-chan repository.PendingDripStream
+	UpdateDripStatus(ctx context.Context, id uint64, status repository.DepositStatus, events ...*repository.OutboxEvent) error
+	GetShadowCursor(ctx context.Context) (uint64, error)
+	GetLastDepositId(ctx context.Context) (uint64, error)
+	SaveShadowDrip(ctx context.Context, item *repository.ShadowDrip) error
+	AddOutboxEvents(ctx context.Context, events ...*repository.OutboxEvent) error
+	AddAuditLog(ctx context.Context, audit *repository.AuditLog) error
+}
+
 type Faucet struct {
-	Web3Client *ethclient.Client
-	Repositroy repository.Metis
+	Network    *utils.Network
+	Web3Client Web3Client
+	Repositroy FaucetRepository
 	Uniswap    utils.Uniswaper
+	Tokens     *Tokens
 
-	Prvkey       *ecdsa.PrivateKey
-	Account      common.Address
+	// Wallets give the drips, each drip is sent from the healthiest wallet
+	Wallets      []*Wallet
 	Eip155Signer types.Signer
-	nonce        uint64
+	// Treasury refills the wallets whose balance is below RefillBelow with RefillAmount, nil means disabled
+	Treasury     *Wallet
+	RefillBelow  *big.Int
+	RefillAmount *big.Int
 
 	DripHeight uint64
 	DripAmount *big.Int
 	MinUSD     float64
+	Budget     Budget
+
+	// WorkerId identifies the faucet among the workers claiming deposits, each worker has its own wallets.
+	// It's the account of the first wallet by default.
+	WorkerId string
+	ClaimTTL time.Duration
+	// CheckDelay is how long the receipts of the drips are checked after sending them, 5s by default
+	CheckDelay time.Duration
+
+	// CheckWorkers is the number of deposits of a batch checked concurrently
+	CheckWorkers int
+	// CheckAtDepositHeight checks the account state of the receiver at the deposit block,
+	// it's only used if the rpc is an archive node
+	CheckAtDepositHeight bool
+	archive              bool
+
+	// FromLimit caps drips per L1 sender within FromWindow, 0 means no limit
+	FromLimit  int
+	FromWindow time.Duration
+
+	// LowBalance is the Metis balance of a wallet to emit the wallet low event, 0 means disabled
+	LowBalance float64
+
+	// DryRun evaluates every deposit and signs the drips, but records them in the shadow drips
+	// rather than broadcasting them. The deposits are read after the cursor instead of being claimed,
+	// so their status is left to the faucet.
+	DryRun bool
+	// DryRunFrom is the deposit id the first dry run starts after, 0 means the last deposit.
+	// A dry run which has recorded drips resumes after them.
+	DryRunFrom   uint64
+	shadowCursor uint64
+
+	health   loopHealth
+	inflight inflight
 }
 
-func (s *Faucet) Initial(basectx context.Context) (err error) {
+func (s *Faucet) Initial(basectx context.Context) error {
 	if s.DripAmount == nil || s.DripAmount.Sign() < 1 {
 		s.DripAmount = big.NewInt(1e16)
 	}
+	if len(s.Wallets) == 0 {
+		return fmt.Errorf("no wallet")
+	}
+	if s.WorkerId == "" {
+		s.WorkerId = s.Wallets[0].Account.Hex()
+	}
+	if s.ClaimTTL <= 0 {
+		s.ClaimTTL = time.Minute * 10
+	}
+	if s.CheckDelay <= 0 {
+		s.CheckDelay = time.Second * 5
+	}
+	if s.Tokens == nil {
+		s.Tokens = NewTokens(s.Web3Client, s.Repositroy)
+	}
 
-	newctx, cancel := context.WithTimeout(basectx, time.Second)
+	newctx, cancel := context.WithTimeout(basectx, time.Second*10)
 	defer cancel()
-	s.nonce, err = s.Web3Client.NonceAt(newctx, s.Account, nil)
-	return
+	// the drips left in flight before a takeover are in the pending nonces once they are broadcast
+	s.retryInflight(newctx)
+	for _, item := range s.Wallets {
+		if err := item.sync(newctx, s.Web3Client); err != nil {
+			return err
+		}
+	}
+	if s.Treasury != nil {
+		if err := s.Treasury.sync(newctx, s.Web3Client); err != nil {
+			return err
+		}
+	}
+	if s.CheckAtDepositHeight {
+		s.archive = s.probeArchive(newctx)
+	}
+	if s.DryRun {
+		cursor, err := s.Repositroy.GetShadowCursor(newctx)
+		if err != nil {
+			return err
+		}
+		// the first dry run doesn't replay the history, which the faucet has processed already
+		if cursor == 0 {
+			if cursor = s.DryRunFrom; cursor == 0 {
+				if cursor, err = s.Repositroy.GetLastDepositId(newctx); err != nil {
+					return err
+				}
+			}
+		}
+		s.shadowCursor = cursor
+		logrus.Infof("Dry run from deposit %d, the drips are not broadcast", cursor)
+	}
+	return nil
+}
+
+// Run sends the drips and checks their receipts until the context is done. It wakes up on the notifications
+// of new deposits, the interval is a fallback of the notifications.
+func (s *Faucet) Run(ctx context.Context, notify <-chan struct{}, interval time.Duration) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-notify:
+		}
+		s.SendDrips(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.CheckDelay):
+			s.CheckDrips(ctx)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+	}
 }
 
 func (s *Faucet) SendDrips(basectx context.Context) {
 	newctx, cancel := context.WithTimeout(basectx, time.Minute*5)
 	defer cancel()
-	if err := s.tryToSendDrip(newctx); err != nil {
+	err := s.tryToSendDrip(newctx)
+	if err != nil {
 		logrus.Errorf("failed to transfer drips: %s", err)
 	}
+	s.health.record(err)
+	if err := s.checkWallets(newctx); err != nil {
+		logrus.Errorf("failed to check wallets: %s", err)
+	}
 }
 
 func (s *Faucet) tryToSendDrip(ctx context.Context) error {
+	s.retryInflight(ctx)
+
+	budget, err := s.BudgetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	dripAmount := utils.ToEther(s.DripAmount)
+	if !budget.Allows(dripAmount) {
+		logrus.Infof("Budget exhausted, waiting until %s", budget.ResetAt())
+		return nil
+	}
+	if budget.MaxDripsPerHour > 0 || budget.MaxMetisPerDay > 0 {
+		logrus.Infof("Budget: %d drips left in this hour, %f Metis left in this day", budget.RemainingDrips(), budget.RemainingMetis())
+	}
+
+	var deposits []*repository.Deposit
+	if s.DryRun {
+		deposits, err = s.Repositroy.GetDepositsAfter(ctx, s.shadowCursor, 20)
+	} else {
+		deposits, err = s.Repositroy.ClaimDeposits(ctx, s.WorkerId, s.ClaimTTL, 20)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the deposits are checked concurrently, then signed one by one in the order of the claim
+	checks := s.checkDeposits(ctx, deposits)
+
 	recset := make(map[string]bool)
-	for item := range s.Repositroy.GetDepositTxStream(ctx, repository.DepositStatusUnprocessed) {
-		if item.Error != nil {
-			return item.Error
+	for i, deposit := range deposits {
+		// no new deposits are taken after the shutdown begins
+		if ctx.Err() != nil {
+			return nil
 		}
 
 		var shouldTransfer = true
-		err := s.shouldTransfer(ctx, item.Data, recset)
+		var reason string
+		var events []*repository.OutboxEvent
+		err := checks[i].err
+		if err == nil {
+			err = s.shouldTransferInOrder(ctx, deposit, checks[i].allowlisted, recset)
+		}
 		if err != nil {
 			if v, ok := err.(ErrorNoNeedToTransfer); ok {
-				logrus.Infof("Don't need to give a drip to %s: %s", item.Data.To, v.msg)
+				logrus.Infof("Don't need to give a drip to %s: %s", deposit.To, v.msg)
 				shouldTransfer = false
+				reason = v.msg
+				events = depositSkipped(deposit, v.msg)
 			} else {
 				return err
 			}
 		}
 
+		if shouldTransfer && !budget.Allows(dripAmount) {
+			logrus.Infof("Budget exhausted, waiting until %s", budget.ResetAt())
+			return nil
+		}
+
+		var wallet *Wallet
 		var drip *repository.Drip
 		var tx *types.Transaction
 		if shouldTransfer {
-			tx, err = s.makeDripTx(ctx, item.Data.To)
+			if wallet = s.pickWallet(); wallet == nil {
+				logrus.Warnf("No wallet can afford a drip")
+				return nil
+			}
+			tx, err = s.makeTransferTx(ctx, wallet, common.HexToAddress(deposit.To), s.DripAmount)
 			if err != nil {
 				return err
 			}
@@ -82,126 +264,219 @@ func (s *Faucet) tryToSendDrip(ctx context.Context) error {
 				return err
 			}
 			drip = &repository.Drip{
-				Pid:    item.Data.Id,
+				Pid:    deposit.Id,
 				Txid:   tx.Hash().String(),
-				From:   s.Account.Hex(),
-				To:     item.Data.To,
-				Amount: utils.ToEther(s.DripAmount),
+				From:   wallet.Account.Hex(),
+				To:     deposit.To,
+				Amount: dripAmount,
 				Rawtx:  rawtx,
 			}
-			recset[item.Data.To] = true
-		}
-		if err := s.Repositroy.NewDrip(ctx, item.Data, drip); err != nil {
-			return err
+			events = dripSent(drip)
 		}
-		if tx != nil && drip != nil {
-			s.nonce += 1
-			logrus.Infof("Drip: send %f Metis to %s [ Tx %s ]", drip.Amount, drip.To, drip.Txid)
-			if err := s.Web3Client.SendTransaction(ctx, tx); err != nil {
+		var committed bool
+		if s.DryRun {
+			if err := s.saveShadowDrip(ctx, deposit, drip, reason); err != nil {
 				return err
 			}
+			// the shadow drips are signed with the nonces the faucet would use, starting from the pending nonce
+			if committed = drip != nil; committed {
+				wallet.spend(tx)
+			}
+		} else if committed, err = s.commitDrip(ctx, wallet, deposit, drip, tx, events); err != nil {
+			return err
+		}
+		if committed {
+			recset[deposit.To] = true
+			budget.Spend(drip.Amount)
 		}
 	}
 	return nil
 }
 
-func (s *Faucet) shouldTransfer(basectx context.Context, item *repository.Deposit, recset map[string]bool) (err error) {
+// saveShadowDrip records the decision of the dry run on the deposit and moves the cursor past it
+func (s *Faucet) saveShadowDrip(ctx context.Context, deposit *repository.Deposit, drip *repository.Drip, reason string) error {
+	var shadow = &repository.ShadowDrip{Pid: deposit.Id, To: deposit.To, Reason: reason, CheckMode: deposit.CheckMode}
+	if drip != nil {
+		shadow.Txid, shadow.From, shadow.Amount, shadow.Rawtx = drip.Txid, drip.From, drip.Amount, drip.Rawtx
+		logrus.Infof("Dry run: drip %f Metis from %s to %s [ Tx %s ]", drip.Amount, drip.From, drip.To, drip.Txid)
+	}
+	if err := s.Repositroy.SaveShadowDrip(ctx, shadow); err != nil {
+		return err
+	}
+	s.shadowCursor = deposit.Id
+	return nil
+}
+
+type depositCheck struct {
+	allowlisted bool
+	err         error
+}
+
+// checkDeposits runs shouldTransfer for the deposits with at most CheckWorkers concurrent checks,
+// the results are in the order of the deposits
+func (s *Faucet) checkDeposits(ctx context.Context, deposits []*repository.Deposit) []depositCheck {
+	var workers = s.CheckWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var checks = make([]depositCheck, len(deposits))
+	var sem = make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, item := range deposits {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, item *repository.Deposit) {
+			defer func() { <-sem; wg.Done() }()
+			checks[i].allowlisted, checks[i].err = s.shouldTransfer(ctx, item)
+		}(i, item)
+	}
+	wg.Wait()
+	return checks
+}
+
+// shouldTransferInOrder runs the checks depending on the drips committed before the deposit in the batch
+func (s *Faucet) shouldTransferInOrder(ctx context.Context, item *repository.Deposit, allowlisted bool, recset map[string]bool) error {
 	if recset[item.To] {
 		return ErrorNoNeedToTransfer{msg: "has transfered in current loop"}
 	}
 
+	// should not be funded by an L1 sender which has collected too many drips
+	if s.FromLimit > 0 && !allowlisted {
+		newctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+		count, err := s.Repositroy.CountDripsByFrom(newctx, item.From, s.FromWindow)
+		if err != nil {
+			return err
+		}
+		if count >= s.FromLimit {
+			return ErrorNoNeedToTransfer{msg: fmt.Sprintf("sender %s has %d drips in %s", item.From, count, s.FromWindow), reason: "sender drip limit"}
+		}
+	}
+	return nil
+}
+
+// shouldTransfer runs the checks which don't depend on the other deposits of the batch,
+// so the deposits can be checked concurrently. allowlisted is set if the fresh account checks are skipped.
+func (s *Faucet) shouldTransfer(basectx context.Context, item *repository.Deposit) (allowlisted bool, err error) {
 	if item.Height < s.DripHeight {
-		return ErrorNoNeedToTransfer{msg: "height < dripHeight"}
+		return false, ErrorNoNeedToTransfer{msg: "height < dripHeight"}
 	}
 
 	newctx, cancel := context.WithTimeout(basectx, time.Second*10)
 	defer cancel()
 
-	var rate float64 = 1
-	if !utils.IsStableL2Token(item.L2Token) {
-		rate, err = s.Uniswap.GetTokenPrice(newctx, item.L1Token)
-		if err != nil {
-			return err
-		}
+	listed, err := s.Repositroy.GetAddressListEntry(newctx, item.To)
+	if err != nil {
+		return false, err
+	}
+	if listed != nil && listed.Kind == repository.AddressListDeny {
+		return false, ErrorNoNeedToTransfer{msg: fmt.Sprintf("denylisted: %s", listed.Reason), reason: "denylisted"}
 	}
 
-	l2token, err := metisl2.NewL2StandardERC20(common.HexToAddress(item.L2Token), s.Web3Client)
+	// should be a genuine token of the standard bridge, or the price of another token is used
+	token, err := s.Tokens.Get(newctx, item.L2Token)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if !token.Standard {
+		return false, ErrorNoNeedToTransfer{msg: fmt.Sprintf("%s is not a standard bridge token", item.L2Token), reason: "not a standard bridge token"}
+	}
+	if token.L1Token != item.L1Token {
+		return false, ErrorNoNeedToTransfer{msg: fmt.Sprintf("l1Token of %s is %s rather than %s", item.L2Token, token.L1Token, item.L1Token), reason: "l1Token mismatch"}
 	}
 
-	decimal, err := l2token.Decimals(&bind.CallOpts{Context: newctx})
-	if err != nil {
-		return err
+	var rate float64 = 1
+	if !s.Network.IsStableL2Token(item.L2Token) {
+		rate, err = s.Uniswap.GetTokenPrice(newctx, item.L1Token)
+		if err != nil {
+			return false, err
+		}
 	}
-	if amount := item.Amount.Readable(int64(decimal)); rate*amount < s.MinUSD {
-		return ErrorNoNeedToTransfer{msg: fmt.Sprintf("Amount %f < Min %f", amount, s.MinUSD)}
+	if amount := item.Amount.Readable(int64(token.Decimals)); rate*amount < s.MinUSD {
+		return false, ErrorNoNeedToTransfer{msg: fmt.Sprintf("Amount %f < Min %f", amount, s.MinUSD), reason: "amount < min usd"}
 	}
 
-	first, err := s.Repositroy.HasGotDrip(newctx, item.To)
+	first, err := s.Repositroy.HasGotDrip(newctx, item.To, item.Id)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if !first {
-		return ErrorNoNeedToTransfer{msg: "transfered before"}
+		return false, ErrorNoNeedToTransfer{msg: "transfered before"}
+	}
+	// the drips of a dry run are not in the drips table
+	if s.DryRun {
+		if first, err = s.Repositroy.HasGotShadowDrip(newctx, item.To, item.Id); err != nil {
+			return false, err
+		}
+		if !first {
+			return false, ErrorNoNeedToTransfer{msg: "transfered before in the dry run"}
+		}
 	}
 
-	// should not have Metis balance
-	balance, err := s.Web3Client.BalanceAt(newctx, common.HexToAddress(item.To), nil)
+	// allowlisted addresses skip the fresh account checks
+	if listed != nil && listed.Kind == repository.AddressListAllow {
+		return true, nil
+	}
+
+	// the balance, the code and the nonce are read in one batch
+	state, err := s.receiverState(newctx, item)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if balance.Sign() > 0 {
-		return ErrorNoNeedToTransfer{msg: "metis balance > 0"}
+
+	// should not have Metis balance
+	if state.balance.Sign() > 0 {
+		return false, ErrorNoNeedToTransfer{msg: "metis balance > 0"}
 	}
 
 	// should be an EOA
-	code, err := s.Web3Client.CodeAt(newctx, common.HexToAddress(item.To), nil)
-	if err != nil {
-		return err
-	}
-	if len(code) > 0 {
-		return ErrorNoNeedToTransfer{msg: "not EOA"}
+	if len(state.code) > 0 {
+		return false, ErrorNoNeedToTransfer{msg: "not EOA"}
 	}
 
 	// should be a fresh address
-	nonce, err := s.Web3Client.NonceAt(newctx, common.HexToAddress(item.To), nil)
-	if err != nil {
-		return err
-	}
-	if nonce > 0 {
-		return ErrorNoNeedToTransfer{msg: "nonce > 0"}
+	if state.nonce > 0 {
+		return false, ErrorNoNeedToTransfer{msg: "nonce > 0"}
 	}
-	return nil
+	return false, nil
 }
 
-func (s *Faucet) makeDripTx(basectx context.Context, toAddr string) (*types.Transaction, error) {
-	newctx, cancel := context.WithTimeout(basectx, time.Second*5)
-	defer cancel()
-
-	gasPrice, err := s.Web3Client.SuggestGasPrice(newctx)
-	if err != nil {
-		return nil, err
+// receiverState reads the account state of the receiver at the deposit block if the rpc is an archive node,
+// or at the latest block otherwise. The mode used is recorded in the deposit.
+func (s *Faucet) receiverState(ctx context.Context, item *repository.Deposit) (*accountState, error) {
+	if s.archive {
+		state, err := getAccountState(ctx, s.Web3Client, common.HexToAddress(item.To), new(big.Int).SetUint64(item.Height))
+		if err == nil {
+			item.CheckMode = repository.CheckModeDeposit
+			return state, nil
+		}
+		// a pruned endpoint of the pool may not have the state
+		logrus.Warnf("Unable to read the state of %s at %d, checking at head: %s", item.To, item.Height, err)
 	}
-
-	receiver := common.HexToAddress(toAddr)
-	gas, err := s.Web3Client.EstimateGas(newctx,
-		ethereum.CallMsg{From: s.Account, To: &receiver, Value: s.DripAmount})
+	state, err := getAccountState(ctx, s.Web3Client, common.HexToAddress(item.To), nil)
 	if err != nil {
 		return nil, err
 	}
+	item.CheckMode = repository.CheckModeHead
+	return state, nil
+}
 
-	rawtx := &types.LegacyTx{
-		Nonce:    s.nonce,
-		GasPrice: gasPrice,
-		Gas:      gas,
-		To:       &receiver,
-		Value:    s.DripAmount,
+// probeArchive reports whether the rpc serves the state of old blocks
+func (s *Faucet) probeArchive(ctx context.Context) bool {
+	if _, err := s.Web3Client.BalanceAt(ctx, s.Wallets[0].Account, big.NewInt(1)); err != nil {
+		logrus.Warnf("The rpc is not an archive node, the deposits are checked at head: %s", err)
+		return false
 	}
-	return types.SignNewTx(s.Prvkey, s.Eip155Signer, rawtx)
+	logrus.Infof("The deposits are checked at the deposit height")
+	return true
 }
 
 func (s *Faucet) CheckDrips(basectx context.Context) {
+	// the drips of a dry run are never broadcast, the drips of the faucet are checked by the faucet
+	if s.DryRun {
+		return
+	}
 	newctx, cancel := context.WithTimeout(basectx, time.Minute*5)
 	defer cancel()
 	if err := s.tryToCheckDrip(newctx); err != nil {
@@ -214,34 +489,40 @@ func (s *Faucet) tryToCheckDrip(ctx context.Context) error {
 		if item.Error != nil {
 			return item.Error
 		}
-		done, err := s.getTxStatus(ctx, item.Data)
+		receipt, err := s.getTxReceipt(ctx, item.Data)
 		if err != nil {
 			return err
 		}
-		if !done {
+		if receipt == nil {
 			var tx = new(types.Transaction)
 			_ = tx.UnmarshalBinary(item.Data.Rawtx)
 			_ = s.Web3Client.SendTransaction(ctx, tx)
 			continue
 		}
+		var failed = receipt.Status == types.ReceiptStatusFailed
+		if failed {
+			logrus.Warnf("Drip of deposit %d is failed [ Tx %s ]", item.Data.Id, item.Data.Txid)
+		}
 		logrus.Infof("Updating deposit %d status [ Tx %s ]", item.Data.Id, item.Data.Txid)
-		if err := s.Repositroy.UpdateDripStatus(ctx, item.Data.Id, repository.DepositStatusDone); err != nil {
+		events := dripDone(item.Data, receipt.BlockNumber.Uint64(), failed)
+		if err := s.Repositroy.UpdateDripStatus(ctx, item.Data.Id, repository.DepositStatusDone, events...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (s *Faucet) getTxStatus(ctx context.Context, tx *repository.PendingDrip) (bool, error) {
+// getTxReceipt returns nil if the drip is not mined yet
+func (s *Faucet) getTxReceipt(ctx context.Context, tx *repository.PendingDrip) (*types.Receipt, error) {
 	newctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 
-	_, err := s.Web3Client.TransactionReceipt(newctx, common.HexToHash(tx.Txid))
+	receipt, err := s.Web3Client.TransactionReceipt(newctx, common.HexToHash(tx.Txid))
 	if err != nil {
 		if err == ethereum.NotFound {
-			return false, nil
+			return nil, nil
 		}
-		return false, err
+		return nil, err
 	}
-	return true, nil
+	return receipt, nil
 }
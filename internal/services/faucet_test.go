@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	testL1Token = "0x0000000000000000000000000000000000000101"
+	testL2Token = "0x0000000000000000000000000000000000000102"
+)
+
+// fakeRepository claims its deposits once and commits drips in memory, no receiver has got a drip before.
+// The other methods are not implemented.
+type fakeRepository struct {
+	FaucetRepository
+
+	mu       sync.Mutex
+	deposits []*repository.Deposit
+	drips    []*repository.Drip
+	skipped  []uint64
+	audits   []*repository.AuditLog
+	// duplicates are the receivers dripped by another worker since they were checked
+	duplicates map[string]bool
+	// lost are the deposits claimed by another worker since they were claimed
+	lost map[uint64]bool
+	// shadowed are the receivers dripped by the dry run, shadows are the decisions it records
+	shadowed      map[string]bool
+	shadows       []*repository.ShadowDrip
+	shadowCursor  uint64
+	lastDepositId uint64
+	// senders are the L1 senders of the dripped deposits by id
+	senders map[uint64]string
+	// claims counts the calls of ClaimDeposits
+	claims int
+	// onNewDrip is called after a drip is committed
+	onNewDrip func(drip *repository.Drip)
+}
+
+func newFakeRepository(deposits ...*repository.Deposit) *fakeRepository {
+	return &fakeRepository{deposits: deposits}
+}
+
+func (f *fakeRepository) ChainId() uint64 {
+	return 1088
+}
+
+func (f *fakeRepository) ClaimDeposits(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*repository.Deposit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deposits := f.deposits
+	f.deposits = nil
+	f.claims++
+	return deposits, nil
+}
+
+// GetPendingDripsStream has no pending drips
+func (f *fakeRepository) GetPendingDripsStream(ctx context.Context) <-chan repository.PendingDripStream {
+	stream := make(chan repository.PendingDripStream)
+	close(stream)
+	return stream
+}
+
+// push adds the deposits to claim and returns how many times the deposits have been claimed and dripped
+func (f *fakeRepository) push(deposits ...*repository.Deposit) (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deposits = append(f.deposits, deposits...)
+	return f.claims, len(f.drips)
+}
+
+func (f *fakeRepository) GetAddressListEntry(ctx context.Context, address string) (*repository.AddressListEntry, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) HasGotDrip(ctx context.Context, address string, pid uint64) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRepository) HasGotShadowDrip(ctx context.Context, address string, pid uint64) (bool, error) {
+	return !f.shadowed[address], nil
+}
+
+func (f *fakeRepository) GetDepositsAfter(ctx context.Context, cursor uint64, limit int) ([]*repository.Deposit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deposits []*repository.Deposit
+	for _, item := range f.deposits {
+		if item.Id > cursor && len(deposits) < limit {
+			deposits = append(deposits, item)
+		}
+	}
+	return deposits, nil
+}
+
+func (f *fakeRepository) SaveShadowDrip(ctx context.Context, item *repository.ShadowDrip) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shadows = append(f.shadows, item)
+	return nil
+}
+
+func (f *fakeRepository) GetShadowCursor(ctx context.Context) (uint64, error) {
+	return f.shadowCursor, nil
+}
+
+func (f *fakeRepository) GetLastDepositId(ctx context.Context) (uint64, error) {
+	return f.lastDepositId, nil
+}
+
+func (f *fakeRepository) NewDrip(ctx context.Context, deposit *repository.Deposit, drip *repository.Drip, events ...*repository.OutboxEvent) error {
+	f.mu.Lock()
+	if drip != nil && f.duplicates[drip.To] {
+		f.mu.Unlock()
+		return fmt.Errorf("NewDrip: %w", repository.ErrDuplicateDrip)
+	}
+	if f.lost[deposit.Id] {
+		f.mu.Unlock()
+		return fmt.Errorf("NewDrip: deposit %d: %w", deposit.Id, repository.ErrClaimLost)
+	}
+	if drip == nil {
+		f.skipped = append(f.skipped, deposit.Id)
+	} else {
+		if drip.CreatedAt.IsZero() {
+			drip.CreatedAt = time.Now()
+		}
+		if f.senders == nil {
+			f.senders = make(map[uint64]string)
+		}
+		f.senders[deposit.Id] = deposit.From
+		f.drips = append(f.drips, drip)
+	}
+	f.mu.Unlock()
+	if drip != nil && f.onNewDrip != nil {
+		f.onNewDrip(drip)
+	}
+	return nil
+}
+
+// GetDripUsage stamps and counts the drips by the local clock, as mysql does with its own
+func (f *fakeRepository) GetDripUsage(ctx context.Context, within time.Duration) (int, float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var count int
+	var amount float64
+	for _, item := range f.drips {
+		if time.Since(item.CreatedAt) <= within {
+			count++
+			amount += item.Amount
+		}
+	}
+	return count, amount, nil
+}
+
+// CountDripsByFrom counts the drips of the sender by the local clock
+func (f *fakeRepository) CountDripsByFrom(ctx context.Context, from string, within time.Duration) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var count int
+	for _, item := range f.drips {
+		if f.senders[item.Pid] == from && time.Since(item.CreatedAt) <= within {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeRepository) AddAuditLog(ctx context.Context, audit *repository.AuditLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audits = append(f.audits, audit)
+	return nil
+}
+
+// newTestFaucet returns a faucet with a rich wallet, which drips to the deposits of the standard test token
+// worth at least 1 USD
+func newTestFaucet(client Web3Client, repo FaucetRepository) *Faucet {
+	prvkey, _ := crypto.GenerateKey()
+	wallet := NewWallet(prvkey)
+	wallet.balance = utils.ToWei(100)
+
+	tokens := NewTokens(client, repo)
+	tokens.tokens[testL2Token] = &repository.Token{Address: testL2Token, L1Token: testL1Token, Decimals: 18, Standard: true}
+	return &Faucet{
+		Network:      &utils.Network{StableL2Tokens: []string{testL2Token}},
+		Web3Client:   client,
+		Repositroy:   repo,
+		Tokens:       tokens,
+		Wallets:      []*Wallet{wallet},
+		Eip155Signer: types.NewEIP155Signer(big.NewInt(1088)),
+		DripHeight:   100,
+		DripAmount:   utils.ToWei(0.01),
+		MinUSD:       1,
+		CheckWorkers: 1,
+	}
+}
+
+// slowListRepository answers the address list lookups of the checks after a delay, counting the concurrent ones
+type slowListRepository struct {
+	*fakeRepository
+
+	listed map[string]*repository.AddressListEntry
+	delays map[string]time.Duration
+
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (f *slowListRepository) GetAddressListEntry(ctx context.Context, address string) (*repository.AddressListEntry, error) {
+	f.mu.Lock()
+	f.active++
+	if f.active > f.maxActive {
+		f.maxActive = f.active
+	}
+	f.mu.Unlock()
+
+	time.Sleep(f.delays[address])
+
+	f.mu.Lock()
+	f.active--
+	f.mu.Unlock()
+	return f.listed[address], nil
+}
+
+func TestFaucet_CheckDeposits(t *testing.T) {
+	repo := &slowListRepository{
+		fakeRepository: newFakeRepository(),
+		listed:         make(map[string]*repository.AddressListEntry),
+		delays:         make(map[string]time.Duration),
+	}
+
+	// the deposits are denylisted, allowlisted or fresh in turn, the later ones are checked faster
+	const count = 9
+	var deposits []*repository.Deposit
+	for i := 0; i < count; i++ {
+		to := fmt.Sprintf("0x%040x", i+1)
+		switch i % 3 {
+		case 0:
+			repo.listed[to] = &repository.AddressListEntry{Address: to, Kind: repository.AddressListDeny}
+		case 1:
+			repo.listed[to] = &repository.AddressListEntry{Address: to, Kind: repository.AddressListAllow}
+		}
+		repo.delays[to] = time.Millisecond * time.Duration(2*(count-i))
+		deposits = append(deposits, &repository.Deposit{Id: uint64(i + 1), Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: to, Amount: bigint.FromBigInt(utils.ToWei(1000))})
+	}
+
+	s := newTestFaucet(&fakeWeb3{}, repo)
+	s.CheckWorkers = 3
+	checks := s.checkDeposits(context.Background(), deposits)
+	if len(checks) != len(deposits) {
+		t.Fatalf("checkDeposits() returns %d results, want %d", len(checks), len(deposits))
+	}
+	for i, item := range checks {
+		var ok bool
+		switch i % 3 {
+		case 0:
+			_, ok = item.err.(ErrorNoNeedToTransfer)
+			ok = ok && !item.allowlisted
+		case 1:
+			ok = item.err == nil && item.allowlisted
+		case 2:
+			ok = item.err == nil && !item.allowlisted
+		}
+		if !ok {
+			t.Errorf("check %d = %+v is not the result of deposit %d", i, item, deposits[i].Id)
+		}
+	}
+	if repo.maxActive > s.CheckWorkers {
+		t.Errorf("%d checks ran concurrently, want at most %d", repo.maxActive, s.CheckWorkers)
+	}
+}
+
+func TestFaucet_ShouldTransferInOrder(t *testing.T) {
+	s := &Faucet{}
+	recset := map[string]bool{"0xa": true}
+	if err := s.shouldTransferInOrder(context.Background(), &repository.Deposit{To: "0xa"}, false, recset); err == nil {
+		t.Error("a receiver should get one drip in a batch")
+	}
+	if err := s.shouldTransferInOrder(context.Background(), &repository.Deposit{To: "0xb"}, false, recset); err != nil {
+		t.Errorf("shouldTransferInOrder() = %v", err)
+	}
+}
+
+func TestFaucet_DryRunCursor(t *testing.T) {
+	tests := []struct {
+		name         string
+		shadowCursor uint64
+		from         uint64
+		want         uint64
+	}{
+		{"first run", 0, 0, 42},
+		{"first run from", 0, 7, 7},
+		{"resumed", 30, 7, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			repo.shadowCursor, repo.lastDepositId = tt.shadowCursor, 42
+			s := newTestFaucet(&fakeWeb3{}, repo)
+			s.DryRun, s.DryRunFrom = true, tt.from
+			if err := s.Initial(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if s.shadowCursor != tt.want {
+				t.Errorf("cursor = %d, want %d", s.shadowCursor, tt.want)
+			}
+		})
+	}
+}
+
+func TestFaucet_DryRunShadowHistory(t *testing.T) {
+	repo := newFakeRepository()
+	repo.shadowed = map[string]bool{"0x0000000000000000000000000000000000000002": true}
+	s := newTestFaucet(&fakeWeb3{}, repo)
+	deposit := &repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: "0x0000000000000000000000000000000000000002", Amount: bigint.FromBigInt(utils.ToWei(1000))}
+
+	// the faucet doesn't read the shadow drips
+	if _, err := s.shouldTransfer(context.Background(), deposit); err != nil {
+		t.Errorf("shouldTransfer() = %v", err)
+	}
+	s.DryRun = true
+	if _, err := s.shouldTransfer(context.Background(), deposit); err == nil {
+		t.Error("a receiver of a shadow drip should be skipped by the dry run")
+	}
+}
+
+func TestFaucet_DryRunNonce(t *testing.T) {
+	newDeposit := func(id uint64, to string) *repository.Deposit {
+		return &repository.Deposit{Id: id, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: to, Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	}
+	repo := newFakeRepository(newDeposit(1, "0x0000000000000000000000000000000000000002"), newDeposit(2, "0x0000000000000000000000000000000000000003"))
+	client := &fakeWeb3{}
+	s := newTestFaucet(client, repo)
+	s.DryRun, s.DryRunFrom = true, 0
+	repo.lastDepositId = 0
+
+	account := s.Wallets[0].Account
+	client.balances = map[common.Address]*big.Int{account: utils.ToWei(100)}
+	client.pendingNonces = map[common.Address]uint64{account: 5}
+	if err := s.Initial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.txs) != 0 || len(repo.shadows) != 2 {
+		t.Fatalf("sent %d shadows %d, want 2 shadow drips not broadcast", len(client.txs), len(repo.shadows))
+	}
+	for i, item := range repo.shadows {
+		var tx = new(types.Transaction)
+		if err := tx.UnmarshalBinary(item.Rawtx); err != nil {
+			t.Fatal(err)
+		}
+		if tx.Nonce() != uint64(5+i) {
+			t.Errorf("shadow drip %d nonce = %d, want %d", i, tx.Nonce(), 5+i)
+		}
+	}
+}
+
+func TestFaucet_ShouldTransferAddressList(t *testing.T) {
+	const (
+		denied  = "0x0000000000000000000000000000000000000001"
+		allowed = "0x0000000000000000000000000000000000000002"
+		other   = "0x0000000000000000000000000000000000000003"
+	)
+	repo := &slowListRepository{
+		fakeRepository: newFakeRepository(),
+		listed: map[string]*repository.AddressListEntry{
+			denied:  {Address: denied, Kind: repository.AddressListDeny, Reason: "abuse"},
+			allowed: {Address: allowed, Kind: repository.AddressListAllow},
+		},
+	}
+	newDeposit := func(to, l2Token string) *repository.Deposit {
+		return &repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: l2Token, To: to, Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	}
+
+	// the receivers of the batcher have a balance, so only the allowlisted one passes the fresh account checks
+	client := &fakeBatcher{}
+	s := newTestFaucet(client, repo)
+
+	// the denylist is checked before the token is looked up, which would hit the rpc for an unknown token
+	_, err := s.shouldTransfer(context.Background(), newDeposit(denied, "0x00000000000000000000000000000000000000ff"))
+	if e, ok := err.(ErrorNoNeedToTransfer); !ok || e.Error() != "denylisted: abuse" {
+		t.Errorf("shouldTransfer() of a denylisted receiver = %v", err)
+	}
+	if len(client.batches) != 0 {
+		t.Errorf("the state of a denylisted receiver should not be read")
+	}
+
+	allowlisted, err := s.shouldTransfer(context.Background(), newDeposit(allowed, testL2Token))
+	if err != nil || !allowlisted {
+		t.Errorf("shouldTransfer() of an allowlisted receiver = %v, %v", allowlisted, err)
+	}
+	if len(client.batches) != 0 {
+		t.Errorf("the state of an allowlisted receiver should not be read")
+	}
+
+	allowlisted, err = s.shouldTransfer(context.Background(), newDeposit(other, testL2Token))
+	if _, ok := err.(ErrorNoNeedToTransfer); !ok || allowlisted {
+		t.Errorf("shouldTransfer() of a receiver with balance = %v, %v", allowlisted, err)
+	}
+	if len(client.batches) != 1 {
+		t.Errorf("the state of the receiver should be read in one batch, got %d", len(client.batches))
+	}
+}
+
+func TestFaucet_FromLimit(t *testing.T) {
+	const sender, other = "0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000a2"
+	newDeposit := func(id uint64, from string, to int) *repository.Deposit {
+		return &repository.Deposit{Id: id, Height: 200, L1Token: testL1Token, L2Token: testL2Token, From: from, To: fmt.Sprintf("0x%040x", to), Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	}
+	// the deposit 100 got its drip before the window, it's below the drip height to be skipped in this batch
+	old := newDeposit(100, sender, 100)
+	old.Height = 50
+	repo := &slowListRepository{
+		fakeRepository: newFakeRepository(old, newDeposit(1, sender, 1), newDeposit(2, sender, 2), newDeposit(3, sender, 3), newDeposit(4, sender, 4), newDeposit(5, other, 5)),
+		listed:         map[string]*repository.AddressListEntry{fmt.Sprintf("0x%040x", 4): {Kind: repository.AddressListAllow}},
+	}
+	repo.drips = []*repository.Drip{{Pid: 100, To: old.To, Amount: 0.01, CreatedAt: time.Now().Add(-time.Hour * 2)}}
+	repo.senders = map[uint64]string{100: sender}
+
+	s := newTestFaucet(&fakeWeb3{}, repo)
+	s.FromLimit, s.FromWindow = 2, time.Hour
+	if err := s.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the drips committed earlier in the batch count, the allowlisted receiver and the other sender are not limited
+	var dripped []uint64
+	for _, item := range repo.drips[1:] {
+		dripped = append(dripped, item.Pid)
+	}
+	if fmt.Sprint(dripped) != "[1 2 4 5]" || fmt.Sprint(repo.skipped) != "[100 3]" {
+		t.Errorf("dripped %v skipped %v, want dripped [1 2 4 5] skipped [100 3]", dripped, repo.skipped)
+	}
+}
+
+func TestFaucet_RunNotify(t *testing.T) {
+	newDeposit := func(id uint64) *repository.Deposit {
+		return &repository.Deposit{Id: id, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: fmt.Sprintf("0x%040x", id), Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	}
+	tests := []struct {
+		name     string
+		notify   bool
+		interval time.Duration
+	}{
+		{"notified", true, time.Hour},
+		{"fallback", false, time.Millisecond * 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeRepository()
+			client := &fakeWeb3{}
+			s := newTestFaucet(client, repo)
+			client.balances = map[common.Address]*big.Int{s.Wallets[0].Account: utils.ToWei(100)}
+			s.CheckDelay = time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			notify := make(chan struct{}, 1)
+			go func() {
+				s.Run(ctx, notify, tt.interval)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			// the deposits are sent once at the start
+			waitFor(t, "the first run", func() bool {
+				claims, _ := repo.push()
+				return claims == 1
+			})
+			repo.push(newDeposit(1))
+			if tt.notify {
+				notify <- struct{}{}
+			}
+			waitFor(t, "the drip", func() bool {
+				_, drips := repo.push()
+				return drips == 1
+			})
+
+			// a faucet waiting for the notifications doesn't poll meanwhile
+			if tt.notify {
+				time.Sleep(time.Millisecond * 50)
+				if claims, _ := repo.push(); claims != 2 {
+					t.Errorf("claimed %d times, want 2 without a notification", claims)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// loopHealth records the outcome of the cycles of a loop, it's safe for concurrent use
+type loopHealth struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	failures    int
+}
+
+func (h *loopHealth) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.failures++
+		return
+	}
+	h.lastSuccess, h.failures = time.Now(), 0
+}
+
+func (h *loopHealth) status() (time.Time, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastSuccess, h.failures
+}
+
+// LastSynced returns when the sync cursor was last advanced or found at the head, zero if never
+func (s *DataSync) LastSynced() time.Time {
+	lastSuccess, _ := s.health.status()
+	return lastSuccess
+}
+
+// LastSucceeded returns when a cycle of sending drips last succeeded, zero if never
+func (s *Faucet) LastSucceeded() time.Time {
+	lastSuccess, _ := s.health.status()
+	return lastSuccess
+}
+
+// ConsecutiveFailures returns how many cycles of sending drips have failed in a row
+func (s *Faucet) ConsecutiveFailures() int {
+	_, failures := s.health.status()
+	return failures
+}
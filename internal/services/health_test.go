@@ -0,0 +1,24 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoopHealth(t *testing.T) {
+	var h loopHealth
+	if last, failures := h.status(); !last.IsZero() || failures != 0 {
+		t.Fatalf("initial status = %s %d", last, failures)
+	}
+
+	h.record(errors.New("rpc down"))
+	h.record(errors.New("rpc down"))
+	if last, failures := h.status(); !last.IsZero() || failures != 2 {
+		t.Errorf("status after failures = %s %d, want zero time and 2", last, failures)
+	}
+
+	h.record(nil)
+	if last, failures := h.status(); last.IsZero() || failures != 0 {
+		t.Errorf("status after success = %s %d, want a time and 0", last, failures)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// detachedContext keeps the values of its parent but is never cancelled with it
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach returns a context which is not interrupted by the shutdown, only by the timeout
+func detach(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, timeout)
+}
+
+// inflightTx is a committed drip and the wallet which signs it
+type inflightTx struct {
+	from common.Address
+	tx   *types.Transaction
+}
+
+// inflight holds the committed drips which are not broadcast yet
+type inflight struct {
+	mu  sync.Mutex
+	txs map[common.Hash]inflightTx
+}
+
+func (f *inflight) add(from common.Address, tx *types.Transaction) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.txs == nil {
+		f.txs = make(map[common.Hash]inflightTx)
+	}
+	f.txs[tx.Hash()] = inflightTx{from: from, tx: tx}
+}
+
+func (f *inflight) remove(hash common.Hash) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.txs, hash)
+}
+
+// list returns the drips in the order of their nonces, so a wallet's drips are sent again without gaps
+func (f *inflight) list() []inflightTx {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var txs = make([]inflightTx, 0, len(f.txs))
+	for _, item := range f.txs {
+		txs = append(txs, item)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].from != txs[j].from {
+			return bytes.Compare(txs[i].from[:], txs[j].from[:]) < 0
+		}
+		return txs[i].tx.Nonce() < txs[j].tx.Nonce()
+	})
+	return txs
+}
+
+// has tells whether the wallet has drips in flight, the later drips of the wallet would wait behind them
+func (f *inflight) has(from common.Address) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range f.txs {
+		if item.from == from {
+			return true
+		}
+	}
+	return false
+}
+
+// commitDrip stores the result of the deposit and broadcasts its drip if any, it reports whether the drip is committed.
+// Once a drip is signed it's committed and broadcast even if the shutdown has begun.
+// A drip which is not committed is dropped without spending the nonce of the wallet.
+func (s *Faucet) commitDrip(basectx context.Context, wallet *Wallet, deposit *repository.Deposit, drip *repository.Drip, tx *types.Transaction, events []*repository.OutboxEvent) (bool, error) {
+	newctx, cancel := detach(basectx, time.Second*30)
+	defer cancel()
+
+	err := s.Repositroy.NewDrip(newctx, deposit, drip, events...)
+	if errors.Is(err, repository.ErrDuplicateDrip) {
+		// another worker has dripped to the receiver since it was checked
+		logrus.Infof("Don't need to give a drip to %s: %s", deposit.To, err)
+		drip, tx = nil, nil
+		err = s.Repositroy.NewDrip(newctx, deposit, nil, depositSkipped(deposit, err.Error())...)
+	}
+	if errors.Is(err, repository.ErrClaimLost) {
+		// the claim has expired and another worker has taken the deposit, which is its to process now
+		logrus.Warnf("Lost the claim of deposit %d: %s", deposit.Id, err)
+		return false, nil
+	}
+	if err != nil || tx == nil {
+		return false, err
+	}
+	wallet.spend(tx)
+	logrus.Infof("Drip: send %f Metis from %s to %s [ Tx %s ]", drip.Amount, drip.From, drip.To, drip.Txid)
+	s.inflight.add(wallet.Account, tx)
+	if err := s.broadcast(newctx, tx); err != nil {
+		wallet.failures++
+		return true, err
+	}
+	wallet.failures = 0
+	return true, nil
+}
+
+// broadcast sends a committed drip in flight, it's removed once the rpc accepts it
+func (s *Faucet) broadcast(ctx context.Context, tx *types.Transaction) error {
+	if err := s.Web3Client.SendTransaction(ctx, tx); err != nil && !isKnownTransaction(err) {
+		return err
+	}
+	s.inflight.remove(tx.Hash())
+	return nil
+}
+
+// retryInflight broadcasts the drips left in flight by the failed broadcasts. The wallet of a drip
+// which is sent again can't be behind its nonce, even if the nonce was read again since it was signed.
+func (s *Faucet) retryInflight(ctx context.Context) {
+	var wallets = make(map[common.Address]*Wallet)
+	for _, item := range s.Wallets {
+		wallets[item.Account] = item
+	}
+	for _, item := range s.inflight.list() {
+		wallet := wallets[item.from]
+		err := s.broadcast(ctx, item.tx)
+		if err != nil && isNonceTooLow(err) {
+			// the nonce is taken by another transaction of the wallet, the drip can never be mined
+			logrus.Errorf("Dropping drip %s of %s, its nonce %d is used: %s", item.tx.Hash(), item.from, item.tx.Nonce(), err)
+			s.inflight.remove(item.tx.Hash())
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("failed to broadcast drip %s again: %s", item.tx.Hash(), err)
+			if wallet != nil {
+				wallet.failures++
+			}
+			continue
+		}
+		logrus.Infof("Drip %s of %s is broadcast again", item.tx.Hash(), item.from)
+		if wallet != nil {
+			wallet.failures = 0
+			if wallet.nonce <= item.tx.Nonce() {
+				wallet.nonce = item.tx.Nonce() + 1
+			}
+		}
+	}
+}
+
+// Inflight returns how many committed drips are not broadcast yet
+func (s *Faucet) Inflight() int {
+	return len(s.inflight.list())
+}
+
+// Drain broadcasts the committed drips which are still in flight until the context is done
+func (s *Faucet) Drain(ctx context.Context) error {
+	for _, item := range s.inflight.list() {
+		if err := s.broadcast(ctx, item.tx); err != nil {
+			logrus.Errorf("Drain: failed to broadcast %s: %s", item.tx.Hash(), err)
+		}
+	}
+	if count := s.Inflight(); count > 0 {
+		return fmt.Errorf("%d committed drips are not broadcast, they are sent again when the faucet restarts", count)
+	}
+	return nil
+}
+
+// isKnownTransaction tells whether the rpc has already got the transaction
+func isKnownTransaction(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// isNonceTooLow tells whether the nonce of the transaction is used by another one
+func isNonceTooLow(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
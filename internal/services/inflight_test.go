@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeWeb3 accepts transactions only while it's up, the accounts are fresh and the gas costs 1 wei.
+// The other methods are not implemented.
+type fakeWeb3 struct {
+	Web3Client
+
+	mu   sync.Mutex
+	down bool
+	sent []common.Hash
+	txs  []*types.Transaction
+	// balances, nonces and pending nonces are 0 unless they are set
+	balances      map[common.Address]*big.Int
+	nonces        map[common.Address]uint64
+	pendingNonces map[common.Address]uint64
+}
+
+func (f *fakeWeb3) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, tx.Hash())
+	f.txs = append(f.txs, tx)
+	return nil
+}
+
+func (f *fakeWeb3) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	if balance, ok := f.balances[account]; ok {
+		return balance, nil
+	}
+	return new(big.Int), nil
+}
+
+func (f *fakeWeb3) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return f.pendingNonces[account], nil
+}
+
+func (f *fakeWeb3) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeWeb3) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return f.nonces[account], nil
+}
+
+func (f *fakeWeb3) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+func (f *fakeWeb3) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return 21000, nil
+}
+
+func (f *fakeWeb3) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func newTestTx(nonce uint64) *types.Transaction {
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1)})
+}
+
+func TestFaucet_BroadcastAfterShutdown(t *testing.T) {
+	client := &fakeWeb3{}
+	faucet := &Faucet{Web3Client: client}
+
+	// the shutdown begins between committing and broadcasting the drip
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	newctx, done := detach(ctx, time.Second)
+	defer done()
+	if err := faucet.broadcast(newctx, newTestTx(0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 1 || faucet.Inflight() != 0 {
+		t.Errorf("sent %d inflight %d, want the drip broadcast", len(client.sent), faucet.Inflight())
+	}
+}
+
+func TestFaucet_SendDripAfterShutdown(t *testing.T) {
+	client := &fakeWeb3{}
+	repo := newFakeRepository(&repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: "0x0000000000000000000000000000000000000002", Amount: bigint.FromBigInt(utils.ToWei(1000))})
+	faucet := newTestFaucet(client, repo)
+
+	// the shutdown begins between committing and broadcasting the drip
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo.onNewDrip = func(drip *repository.Drip) { cancel() }
+
+	if err := faucet.tryToSendDrip(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the shutdown should have begun")
+	}
+	if len(repo.drips) != 1 {
+		t.Fatalf("committed %d drips, want 1", len(repo.drips))
+	}
+	if len(client.sent) != 1 || client.sent[0].Hex() != repo.drips[0].Txid || faucet.Inflight() != 0 {
+		t.Errorf("sent %v inflight %d, want the committed drip broadcast", client.sent, faucet.Inflight())
+	}
+}
+
+func TestFaucet_CommitDuplicateDrip(t *testing.T) {
+	client := &fakeWeb3{}
+	deposit := &repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: "0x0000000000000000000000000000000000000002", Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	repo := newFakeRepository(deposit)
+	repo.duplicates = map[string]bool{deposit.To: true}
+	faucet := newTestFaucet(client, repo)
+
+	if err := faucet.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.drips) != 0 || len(repo.skipped) != 1 || repo.skipped[0] != deposit.Id {
+		t.Errorf("drips %d skipped %v, want the deposit skipped", len(repo.drips), repo.skipped)
+	}
+	if len(client.sent) != 0 || faucet.Wallets[0].nonce != 0 {
+		t.Errorf("sent %d nonce %d, want the signed drip dropped", len(client.sent), faucet.Wallets[0].nonce)
+	}
+}
+
+func TestFaucet_CommitClaimLost(t *testing.T) {
+	client := &fakeWeb3{}
+	lost := &repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: "0x0000000000000000000000000000000000000002", Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	next := &repository.Deposit{Id: 2, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: lost.To, Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	repo := newFakeRepository(lost, next)
+	repo.lost = map[uint64]bool{lost.Id: true}
+	faucet := newTestFaucet(client, repo)
+
+	if err := faucet.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the drip of the lost deposit is dropped and its nonce is given to the next deposit
+	if len(repo.drips) != 1 || repo.drips[0].Pid != next.Id {
+		t.Fatalf("drips %+v, want only the drip of the next deposit", repo.drips)
+	}
+	if len(client.txs) != 1 || client.txs[0].Nonce() != 0 || faucet.Wallets[0].nonce != 1 {
+		t.Errorf("sent %d nonce %d, want the next drip sent with the unused nonce", len(client.txs), faucet.Wallets[0].nonce)
+	}
+}
+
+func TestFaucet_Drain(t *testing.T) {
+	client := &fakeWeb3{down: true}
+	faucet := &Faucet{Web3Client: client}
+
+	// committed drips which failed to be broadcast stay in flight
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx := newTestTx(nonce)
+		faucet.inflight.add(common.Address{}, tx)
+		if err := faucet.broadcast(context.Background(), tx); err == nil {
+			t.Fatal("broadcast should fail while the rpc is down")
+		}
+	}
+	if faucet.Inflight() != 3 {
+		t.Fatalf("inflight = %d, want 3", faucet.Inflight())
+	}
+
+	if err := faucet.Drain(context.Background()); err == nil {
+		t.Error("drain should fail while the rpc is down")
+	}
+
+	client.setDown(false)
+	if err := faucet.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if faucet.Inflight() != 0 || len(client.sent) != 3 {
+		t.Errorf("inflight %d sent %d, want no committed drip left unbroadcast", faucet.Inflight(), len(client.sent))
+	}
+}
+
+func TestFaucet_RetryInflight(t *testing.T) {
+	newDeposit := func(id uint64, to string) *repository.Deposit {
+		return &repository.Deposit{Id: id, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: to, Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	}
+	client := &fakeWeb3{down: true}
+	repo := newFakeRepository(newDeposit(1, "0x0000000000000000000000000000000000000002"))
+	faucet := newTestFaucet(client, repo)
+	wallet := faucet.Wallets[0]
+
+	if err := faucet.tryToSendDrip(context.Background()); err == nil {
+		t.Fatal("tryToSendDrip should fail while the rpc is down")
+	}
+	if faucet.Inflight() != 1 || wallet.nonce != 1 {
+		t.Fatalf("inflight %d nonce %d, want the drip in flight", faucet.Inflight(), wallet.nonce)
+	}
+	// the wallet waits behind its drip in flight
+	if faucet.pickWallet() != nil {
+		t.Error("a wallet with drips in flight should not be picked")
+	}
+
+	// the nonce is read again before the rpc is back, e.g. after a takeover
+	wallet.nonce = 0
+	client.setDown(false)
+	repo.deposits = []*repository.Deposit{newDeposit(2, "0x0000000000000000000000000000000000000003")}
+	if err := faucet.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if faucet.Inflight() != 0 || len(client.txs) != 2 {
+		t.Fatalf("inflight %d sent %d, want both drips broadcast", faucet.Inflight(), len(client.txs))
+	}
+	if client.txs[0].Nonce() != 0 || client.txs[1].Nonce() != 1 || client.txs[1].Hash().Hex() != repo.drips[1].Txid {
+		t.Errorf("nonces %d %d, want the drip in flight sent before the new one", client.txs[0].Nonce(), client.txs[1].Nonce())
+	}
+}
+
+func TestFaucet_RetryInflightNonceTooLow(t *testing.T) {
+	client := &nonceTooLowWeb3{}
+	faucet := newTestFaucet(client, newFakeRepository())
+	faucet.inflight.add(faucet.Wallets[0].Account, newTestTx(0))
+
+	faucet.retryInflight(context.Background())
+	if faucet.Inflight() != 0 || faucet.pickWallet() == nil {
+		t.Errorf("inflight %d, want the drip with a used nonce dropped", faucet.Inflight())
+	}
+}
+
+// nonceTooLowWeb3 rejects every transaction as replaced
+type nonceTooLowWeb3 struct {
+	fakeWeb3
+}
+
+func (f *nonceTooLowWeb3) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return errors.New("nonce too low")
+}
+
+type testContextKey struct{}
+
+func TestDetach(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "value"))
+	cancel()
+
+	newctx, done := detach(ctx, time.Millisecond*10)
+	defer done()
+	if newctx.Err() != nil {
+		t.Error("detached context should not be cancelled with its parent")
+	}
+	if newctx.Value(testContextKey{}) != "value" {
+		t.Error("detached context should keep the values of its parent")
+	}
+	<-newctx.Done()
+	if newctx.Err() != context.DeadlineExceeded {
+		t.Errorf("err = %v, want deadline exceeded", newctx.Err())
+	}
+}
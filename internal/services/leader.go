@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// leaseStore is implemented by repository.Metis
+type leaseStore interface {
+	AcquireLease(ctx context.Context, role, holder string, ttl time.Duration) (uint64, error)
+	ReleaseLease(ctx context.Context, role, holder string, token uint64) error
+}
+
+// Leader runs a role on one replica at a time. The replicas campaign for the lease of the role,
+// the holder renews it and a standby takes over once it expires.
+type Leader struct {
+	Repositroy leaseStore
+	Role       string
+	Holder     string
+	TTL        time.Duration
+	// Fence gets the fencing token while the lease is held, the writes of the role are checked with it
+	Fence *repository.Fence
+}
+
+// Run campaigns until the context is done and runs fn while holding the lease,
+// the context of fn is cancelled once the lease is lost. An error of fn is returned.
+func (l *Leader) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	var interval = l.TTL / 3
+	for {
+		token, err := l.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("%s: failed to acquire lease: %s", l.Role, err)
+		}
+		if token != 0 {
+			logrus.Infof("%s: %s is the leader with token %d", l.Role, l.Holder, token)
+			l.Fence.SetToken(token)
+			err := l.lead(ctx, token, fn)
+			l.Fence.SetToken(0)
+			if err != nil {
+				l.release(token)
+				return err
+			}
+			if ctx.Err() != nil {
+				l.release(token)
+				return nil
+			}
+			logrus.Warnf("%s: %s lost the lease with token %d", l.Role, l.Holder, token)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lead runs fn and renews the lease until fn returns or the lease is lost
+func (l *Leader) lead(ctx context.Context, token uint64, fn func(ctx context.Context) error) error {
+	leadctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var done = make(chan error, 1)
+	go func() { done <- fn(leadctx) }()
+
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			renewed, err := l.acquire(ctx)
+			if err == nil && renewed == token {
+				continue
+			}
+			if err != nil && ctx.Err() == nil {
+				logrus.Errorf("%s: failed to renew lease: %s", l.Role, err)
+			}
+			cancel()
+			<-done
+			return nil
+		}
+	}
+}
+
+// Leading tells whether the replica holds the lease of the role
+func (l *Leader) Leading() bool {
+	return l.Fence.Token() != 0
+}
+
+func (l *Leader) acquire(ctx context.Context) (uint64, error) {
+	newctx, cancel := context.WithTimeout(ctx, l.TTL/3)
+	defer cancel()
+	return l.Repositroy.AcquireLease(newctx, l.Role, l.Holder, l.TTL)
+}
+
+func (l *Leader) release(token uint64) {
+	newctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := l.Repositroy.ReleaseLease(newctx, l.Role, l.Holder, token); err != nil {
+		logrus.Errorf("%s: failed to release lease: %s", l.Role, err)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+// fakeLeases keeps the leases in memory with the semantics of the leases table
+type fakeLeases struct {
+	mu     sync.Mutex
+	holder string
+	token  uint64
+	expiry time.Time
+}
+
+func (f *fakeLeases) AcquireLease(ctx context.Context, role, holder string, ttl time.Duration) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case f.holder == holder:
+	case !time.Now().Before(f.expiry):
+		f.token++
+	default:
+		return 0, nil
+	}
+	f.holder, f.expiry = holder, time.Now().Add(ttl)
+	return f.token, nil
+}
+
+func (f *fakeLeases) ReleaseLease(ctx context.Context, role, holder string, token uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder == holder && f.token == token {
+		f.expiry = time.Now()
+	}
+	return nil
+}
+
+func TestLeader_Failover(t *testing.T) {
+	var leases = new(fakeLeases)
+	var running = make(chan string, 10)
+
+	var mu sync.Mutex
+	var active = make(map[string]bool)
+	role := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			active[name] = true
+			if len(active) > 1 {
+				t.Errorf("%d leaders are running at the same time", len(active))
+			}
+			mu.Unlock()
+			running <- name
+
+			<-ctx.Done()
+			mu.Lock()
+			delete(active, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	newLeader := func(name string) *Leader {
+		return &Leader{Repositroy: leases, Role: "faucet", Holder: name, TTL: time.Millisecond * 90, Fence: repository.NewFence("faucet", name)}
+	}
+	first, second := newLeader("first"), newLeader("second")
+
+	ctx1, stop1 := context.WithCancel(context.Background())
+	done1 := make(chan error, 1)
+	go func() { done1 <- first.Run(ctx1, role("first")) }()
+	if got := <-running; got != "first" {
+		t.Fatalf("leader = %s, want first", got)
+	}
+	if first.Fence.Token() != 1 {
+		t.Errorf("token of first = %d, want 1", first.Fence.Token())
+	}
+
+	ctx2, stop2 := context.WithCancel(context.Background())
+	defer stop2()
+	done2 := make(chan error, 1)
+	go func() { done2 <- second.Run(ctx2, role("second")) }()
+
+	// the standby doesn't take over while the leader renews its lease
+	select {
+	case got := <-running:
+		t.Fatalf("%s is running while the first holds the lease", got)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	stop1()
+	if err := <-done1; err != nil {
+		t.Fatal(err)
+	}
+	if first.Fence.Token() != 0 {
+		t.Errorf("token of first = %d after stepping down, want 0", first.Fence.Token())
+	}
+
+	select {
+	case got := <-running:
+		if got != "second" {
+			t.Fatalf("leader = %s, want second", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the standby didn't take over")
+	}
+	if second.Fence.Token() != 2 {
+		t.Errorf("token of second = %d, want 2", second.Fence.Token())
+	}
+
+	stop2()
+	if err := <-done2; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeader_LostLease(t *testing.T) {
+	var leases = new(fakeLeases)
+	leader := &Leader{Repositroy: leases, Role: "sync", Holder: "first", TTL: time.Millisecond * 90, Fence: repository.NewFence("sync", "first")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lost = make(chan struct{})
+	var runs int
+	go func() {
+		_ = leader.Run(ctx, func(ctx context.Context) error {
+			runs++
+			if runs == 1 {
+				// another replica takes the lease over, the renewal finds the token changed
+				leases.mu.Lock()
+				leases.holder, leases.token = "other", leases.token+1
+				leases.expiry = time.Now().Add(time.Millisecond * 50)
+				leases.mu.Unlock()
+				<-ctx.Done()
+				close(lost)
+				return nil
+			}
+			<-ctx.Done()
+			return nil
+		})
+	}()
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("the role should be stopped once the lease is lost")
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+// NatsSink publishes the events to NATS with the core protocol, the subject of an event is
+// "<subject>.<event>", e.g. faucet.drip.sent. Each batch ends with a PING, so Publish returns only after
+// the server has processed the events. The events carry a Nats-Msg-Id header if the server supports headers,
+// a JetStream stream drops the events published again with it. TLS is not supported.
+type NatsSink struct {
+	addr    string
+	subject string
+	user    string
+	pass    string
+	token   string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	headers bool
+}
+
+// NewNatsSink creates the sink of the spec nats://[user:pass@|token@]host:port/subject, it connects on the first publish
+func NewNatsSink(spec string) (*NatsSink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("nats sink: %s", err)
+	}
+	sink := &NatsSink{addr: u.Host, subject: strings.Trim(u.Path, "/")}
+	if u.Port() == "" {
+		sink.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if sink.subject == "" || strings.ContainsAny(sink.subject, " \t\r\n/") {
+		return nil, fmt.Errorf("nats sink: invalid subject %q", sink.subject)
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			sink.user, sink.pass = u.User.Username(), pass
+		} else {
+			sink.token = u.User.Username()
+		}
+	}
+	return sink, nil
+}
+
+type natsInfo struct {
+	Headers     bool `json:"headers"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	Headers  bool   `json:"headers"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+func (n *NatsSink) Publish(ctx context.Context, events []*repository.OutboxEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := n.publish(ctx, events); err != nil {
+		// the connection is in an unknown state, the next publish connects again
+		n.close()
+		return fmt.Errorf("nats sink: %w", err)
+	}
+	return nil
+}
+
+func (n *NatsSink) publish(ctx context.Context, events []*repository.OutboxEvent) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	n.setDeadline(ctx)
+
+	w := bufio.NewWriter(n.conn)
+	for _, item := range events {
+		data, err := json.Marshal(sinkEvent{OutboxEvent: item, Data: item.Payload})
+		if err != nil {
+			return err
+		}
+		subject := n.subject + "." + item.Event
+		if n.headers {
+			header := fmt.Sprintf("NATS/1.0\r\nNats-Msg-Id: %d:%d\r\n\r\n", item.ChainId, item.Id)
+			fmt.Fprintf(w, "HPUB %s %d %d\r\n%s%s\r\n", subject, len(header), len(header)+len(data), header, data)
+		} else {
+			fmt.Fprintf(w, "PUB %s %d\r\n%s\r\n", subject, len(data), data)
+		}
+	}
+	if _, err := w.WriteString("PING\r\n"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+func (n *NatsSink) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	n.setDeadline(ctx)
+
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		return fmt.Errorf("parse info: %w", err)
+	}
+	if info.TLSRequired {
+		return errors.New("the server requires tls, which is not supported")
+	}
+	n.headers = info.Headers
+
+	connect, err := json.Marshal(natsConnect{
+		Name: "metis-bridge-faucet", Lang: "go", Version: "1", Protocol: 1, Headers: info.Headers,
+		User: n.user, Pass: n.pass, Token: n.token,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(n.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// waitPong reads until the PONG of the last PING, the PINGs of the server are answered meanwhile
+func (n *NatsSink) waitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *NatsSink) readLine() (string, error) {
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (n *NatsSink) setDeadline(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Second * 30)
+	}
+	_ = n.conn.SetDeadline(deadline)
+}
+
+func (n *NatsSink) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn, n.r = nil, nil
+	}
+}
+
+func (n *NatsSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.close()
+	return nil
+}
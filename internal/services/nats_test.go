@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+type natsMessage struct {
+	subject string
+	header  string
+	data    string
+}
+
+// fakeNats is a NATS server with headers, it rejects the first batch if reject is set
+type fakeNats struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	connects []string
+	messages []natsMessage
+	reject   bool
+}
+
+func newFakeNats(t *testing.T) *fakeNats {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	server := &fakeNats{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (f *fakeNats) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"headers\":true}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "CONNECT":
+			f.mu.Lock()
+			f.connects = append(f.connects, strings.TrimSpace(strings.TrimPrefix(line, "CONNECT")))
+			f.mu.Unlock()
+		case "PING":
+			f.mu.Lock()
+			reject := f.reject
+			f.reject = false
+			f.mu.Unlock()
+			if reject {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation'\r\n")
+				return
+			}
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			headerLen, _ := strconv.Atoi(fields[2])
+			total, _ := strconv.Atoi(fields[3])
+			body := make([]byte, total+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, natsMessage{subject: fields[1], header: string(body[:headerLen]), data: string(body[headerLen:total])})
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestNatsSink(t *testing.T) {
+	server := newFakeNats(t)
+	sink, err := NewNatsSink("nats://faucet:secret@" + server.ln.Addr().String() + "/faucet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	events := []*repository.OutboxEvent{
+		{Id: 1, ChainId: 1088, Event: EventDepositIndexed, Payload: []byte(`{"txid":"0x01"}`)},
+		{Id: 2, ChainId: 1088, Event: EventDripSent, Payload: []byte(`{"depositId":1}`)},
+	}
+	if err := sink.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(server.messages))
+	}
+	if msg := server.messages[1]; msg.subject != "faucet.drip.sent" || !strings.Contains(msg.header, "Nats-Msg-Id: 1088:2") {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	var data sinkEvent
+	if err := json.Unmarshal([]byte(server.messages[0].data), &data); err != nil || data.Id != 1 || string(data.Data) != `{"txid":"0x01"}` {
+		t.Errorf("unexpected data %q: %v", server.messages[0].data, err)
+	}
+	var connect natsConnect
+	if err := json.Unmarshal([]byte(server.connects[0]), &connect); err != nil || connect.User != "faucet" || connect.Pass != "secret" || !connect.Headers {
+		t.Errorf("unexpected connect %q: %v", server.connects[0], err)
+	}
+}
+
+func TestNatsSink_Reconnect(t *testing.T) {
+	server := newFakeNats(t)
+	sink, err := NewNatsSink("nats://" + server.ln.Addr().String() + "/faucet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	events := []*repository.OutboxEvent{{Id: 1, ChainId: 1088, Event: EventDripSent, Payload: []byte(`{}`)}}
+	if err := sink.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	// the batch is not acknowledged, so it's published again on a new connection
+	server.mu.Lock()
+	server.reject = true
+	server.mu.Unlock()
+	if err := sink.Publish(context.Background(), events); err == nil {
+		t.Fatal("Publish() should fail if the server rejects the batch")
+	}
+	if err := sink.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.connects) != 2 {
+		t.Errorf("connected %d times, want 2", len(server.connects))
+	}
+}
+
+func TestNewNatsSink(t *testing.T) {
+	tests := []struct {
+		spec    string
+		addr    string
+		wantErr bool
+	}{
+		{"nats://localhost/faucet", "localhost:4222", false},
+		{"nats://token@10.0.0.1:4223/faucet.events", "10.0.0.1:4223", false},
+		{"nats://localhost", "", true},
+		{"nats://localhost/a b", "", true},
+	}
+	for _, tt := range tests {
+		sink, err := NewNatsSink(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewNatsSink(%q) = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && sink.addr != tt.addr {
+			t.Errorf("NewNatsSink(%q) addr = %s, want %s", tt.spec, sink.addr, tt.addr)
+		}
+	}
+}
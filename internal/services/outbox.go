@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/sirupsen/logrus"
+)
+
+// The events of the outbox, the webhooks and the sink get the same events
+const (
+	EventDepositIndexed = "deposit.indexed"
+	EventDepositSkipped = "deposit.skipped"
+	EventDripSent       = "drip.sent"
+	EventDripConfirmed  = "drip.confirmed"
+	EventDripFailed     = "drip.failed"
+	EventWalletLow      = "wallet.low"
+)
+
+type depositPayload struct {
+	Id       uint64     `json:"id,omitempty"`
+	Txid     string     `json:"txid"`
+	LogIndex int64      `json:"logIndex"`
+	Height   uint64     `json:"height"`
+	L1Token  string     `json:"l1token"`
+	L2Token  string     `json:"l2token"`
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Amount   bigint.Int `json:"amount"`
+	Status   string     `json:"status"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+type dripPayload struct {
+	DepositId uint64  `json:"depositId"`
+	Txid      string  `json:"txid"`
+	From      string  `json:"from,omitempty"`
+	To        string  `json:"to,omitempty"`
+	Amount    float64 `json:"amount,omitempty"`
+	Block     uint64  `json:"block,omitempty"`
+}
+
+type walletPayload struct {
+	Account   string  `json:"account"`
+	Balance   float64 `json:"balance"`
+	Threshold float64 `json:"threshold"`
+}
+
+// newEvent returns the event to write with a change, the repository drops it if the outbox is disabled
+func newEvent(name, dedupKey string, payload interface{}) []*repository.OutboxEvent {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logrus.Errorf("outbox: marshal %s payload: %s", name, err)
+		return nil
+	}
+	return []*repository.OutboxEvent{{Event: name, DedupKey: dedupKey, Payload: data}}
+}
+
+func depositsIndexed(deposits []*repository.Deposit) []*repository.OutboxEvent {
+	var events []*repository.OutboxEvent
+	for _, item := range deposits {
+		key := fmt.Sprintf("%s:%d", item.Txid, item.LogIndex.Int64)
+		events = append(events, newEvent(EventDepositIndexed, key, newDepositPayload(item, ""))...)
+	}
+	return events
+}
+
+func depositSkipped(deposit *repository.Deposit, reason string) []*repository.OutboxEvent {
+	return newEvent(EventDepositSkipped, strconv.FormatUint(deposit.Id, 10), newDepositPayload(deposit, reason))
+}
+
+func dripSent(drip *repository.Drip) []*repository.OutboxEvent {
+	return newEvent(EventDripSent, drip.Txid, dripPayload{DepositId: drip.Pid, Txid: drip.Txid, From: drip.From, To: drip.To, Amount: drip.Amount})
+}
+
+func dripDone(drip *repository.PendingDrip, block uint64, failed bool) []*repository.OutboxEvent {
+	var name = EventDripConfirmed
+	if failed {
+		name = EventDripFailed
+	}
+	return newEvent(name, drip.Txid, dripPayload{DepositId: drip.Id, Txid: drip.Txid, Block: block})
+}
+
+func newDepositPayload(item *repository.Deposit, reason string) depositPayload {
+	return depositPayload{
+		Id:       item.Id,
+		Txid:     item.Txid,
+		LogIndex: item.LogIndex.Int64,
+		Height:   item.Height,
+		L1Token:  item.L1Token,
+		L2Token:  item.L2Token,
+		From:     item.From,
+		To:       item.To,
+		Amount:   item.Amount,
+		Status:   item.Status.String(),
+		Reason:   reason,
+	}
+}
+
+// Sink delivers outbox events to the downstream consumers.
+// Publish returns nil only after every event is accepted, the events are published again otherwise,
+// so consumers should tell duplicates apart with the event id.
+type Sink interface {
+	Publish(ctx context.Context, events []*repository.OutboxEvent) error
+	Close() error
+}
+
+// NewSink creates the sink of the spec, which is "stdout", "file:<path>" or "nats://host:port/subject"
+func NewSink(spec string) (Sink, error) {
+	switch {
+	case strings.HasPrefix(spec, "nats://"):
+		return NewNatsSink(spec)
+	case spec == "stdout":
+		return &FileSink{w: os.Stdout}, nil
+	case strings.HasPrefix(spec, "file:"):
+		f, err := os.OpenFile(strings.TrimPrefix(spec, "file:"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &FileSink{w: f, file: f}, nil
+	}
+	return nil, fmt.Errorf("unknown outbox sink %q", spec)
+}
+
+// FileSink writes the events as json lines, it can be shared by the publishers of several chains
+type FileSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+type sinkEvent struct {
+	*repository.OutboxEvent
+	Data json.RawMessage `json:"data"`
+}
+
+func (f *FileSink) Publish(ctx context.Context, events []*repository.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	encoder := json.NewEncoder(f.w)
+	for _, item := range events {
+		if err := encoder.Encode(sinkEvent{OutboxEvent: item, Data: item.Payload}); err != nil {
+			return err
+		}
+	}
+	if f.file != nil {
+		return f.file.Sync()
+	}
+	return nil
+}
+
+func (f *FileSink) Close() error {
+	if f.file != nil {
+		return f.file.Close()
+	}
+	return nil
+}
+
+// Publisher moves the outbox events of a chain to the sink in the order they are written
+type Publisher struct {
+	Repositroy repository.Metis
+	Sink       Sink
+	BatchSize  int
+}
+
+// Run publishes the events periodically until the context is done
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if err := p.Publish(ctx); err != nil {
+				logrus.Errorf("failed to publish outbox events: %s", err)
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// Publish moves the unpublished events in batches until there is none left
+func (p *Publisher) Publish(basectx context.Context) error {
+	var batchSize = p.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	for {
+		newctx, cancel := context.WithTimeout(basectx, time.Minute)
+		count, err := p.publishBatch(newctx, batchSize)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if count < batchSize {
+			return nil
+		}
+	}
+}
+
+func (p *Publisher) publishBatch(ctx context.Context, batchSize int) (int, error) {
+	events, err := p.Repositroy.GetUnpublishedOutboxEvents(ctx, batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if err := p.Sink.Publish(ctx, events); err != nil {
+		return 0, fmt.Errorf("publish: %w", err)
+	}
+
+	var ids = make([]uint64, 0, len(events))
+	for _, item := range events {
+		ids = append(ids, item.Id)
+	}
+	if err := p.Repositroy.MarkOutboxPublished(ctx, ids); err != nil {
+		return 0, err
+	}
+	logrus.Debugf("Published %d outbox events", len(events))
+	return len(events), nil
+}
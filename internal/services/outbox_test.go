@@ -0,0 +1,56 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+func TestFileSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &FileSink{w: &buf}
+
+	events := []*repository.OutboxEvent{
+		{Id: 1, ChainId: 1088, Event: EventDepositIndexed, Payload: []byte(`{"txid":"0x01"}`)},
+		{Id: 2, ChainId: 1088, Event: EventDripSent, Payload: []byte(`{"depositId":1}`)},
+	}
+	if err := sink.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %s", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if lines[0]["id"] != float64(1) || lines[0]["event"] != EventDepositIndexed || lines[0]["chainId"] != float64(1088) {
+		t.Errorf("unexpected first line %v", lines[0])
+	}
+	if data, ok := lines[1]["data"].(map[string]interface{}); !ok || data["depositId"] != float64(1) {
+		t.Errorf("unexpected data of second line %v", lines[1])
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	if _, err := NewSink("kafka://localhost"); err == nil {
+		t.Error("unknown sink should fail")
+	}
+	sink, err := NewSink("file:" + t.TempDir() + "/events.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Error(err)
+	}
+}
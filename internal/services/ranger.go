@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// a range which is fetched faster than this can grow
+const fastRangeFetch = time.Second * 5
+
+// adaptiveRange sizes the block range of eth_getLogs requests.
+// It grows while the requests succeed quickly and shrinks when the node rejects the range as too large
+// or times out on it. A timeout doesn't shrink it below the initial size, which may be a slow node.
+type adaptiveRange struct {
+	size, min, base, max uint64
+}
+
+func newAdaptiveRange(size, max uint64) *adaptiveRange {
+	if size == 0 {
+		size = 1
+	}
+	if max < size {
+		max = size
+	}
+	return &adaptiveRange{size: size, min: 1, base: size, max: max}
+}
+
+func (r *adaptiveRange) succeed(elapsed time.Duration) {
+	if elapsed >= fastRangeFetch || r.size >= r.max {
+		return
+	}
+	if r.size *= 2; r.size > r.max {
+		r.size = r.max
+	}
+}
+
+// shrink halves the range after the error and reports false if it can not be smaller
+func (r *adaptiveRange) shrink(err error) bool {
+	var floor = r.min
+	if isTimeout(err) {
+		floor = r.base
+	}
+	if r.size <= floor {
+		return false
+	}
+	if r.size /= 2; r.size < floor {
+		r.size = floor
+	}
+	return true
+}
+
+// the errors of eth_getLogs rejecting a range, they don't go away unless the range is smaller
+var rangeTooLargeMessages = []string{
+	"query returned more than",
+	"block range",
+	"limit exceeded",
+	"response size",
+}
+
+// rate limits share words with the range errors, such as "rate limit exceeded"
+var rateLimitMessages = []string{
+	"rate limit",
+	"too many requests",
+}
+
+// isRangeTooLarge reports whether a range request could succeed with a smaller range,
+// the node rejects the range or times out on it. Rate limits are transient, they are retried with the same range.
+func isRangeTooLarge(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, item := range rateLimitMessages {
+		if strings.Contains(msg, item) {
+			return false
+		}
+	}
+	if isTimeout(err) {
+		return true
+	}
+	for _, item := range rangeTooLargeMessages {
+		if strings.Contains(msg, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTimeout reports whether the request timed out, on the client or on the node
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out")
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRange(t *testing.T) {
+	r := newAdaptiveRange(20, 100)
+
+	r.succeed(time.Second)
+	if r.size != 40 {
+		t.Errorf("size after fast fetch = %d, want 40", r.size)
+	}
+	r.succeed(time.Second * 10)
+	if r.size != 40 {
+		t.Errorf("size after slow fetch = %d, want 40", r.size)
+	}
+	r.succeed(time.Second)
+	r.succeed(time.Second)
+	if r.size != 100 {
+		t.Errorf("size should be capped to max, got %d", r.size)
+	}
+
+	var shrinks int
+	for r.shrink(errors.New("block range is too wide")) {
+		shrinks++
+	}
+	if r.size != 1 || shrinks != 6 {
+		t.Errorf("size after shrinking = %d in %d shrinks, want 1 in 6", r.size, shrinks)
+	}
+}
+
+func TestAdaptiveRange_ShrinkTimeout(t *testing.T) {
+	r := newAdaptiveRange(20, 100)
+	r.size = 100
+
+	var shrinks int
+	for r.shrink(context.DeadlineExceeded) {
+		shrinks++
+	}
+	if r.size != 20 || shrinks != 3 {
+		t.Errorf("size after timing out = %d in %d shrinks, want the initial 20 in 3", r.size, shrinks)
+	}
+	// the node rejecting the range still shrinks it below the initial size
+	if !r.shrink(errors.New("query returned more than 10000 results")) || r.size != 10 {
+		t.Errorf("size after a range error = %d, want 10", r.size)
+	}
+}
+
+func TestNewAdaptiveRange(t *testing.T) {
+	if r := newAdaptiveRange(50000, 5000); r.max != 50000 {
+		t.Errorf("max should not be less than the initial size, got %d", r.max)
+	}
+	if r := newAdaptiveRange(0, 5000); r.size != 1 {
+		t.Errorf("size should be at least 1, got %d", r.size)
+	}
+}
+
+func TestIsRangeTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", fmt.Errorf("filter: %w", context.Canceled), false},
+		{"deadline", fmt.Errorf("filter: %w", context.DeadlineExceeded), true},
+		{"timeout", errors.New("i/o timeout"), true},
+		{"too many requests", errors.New("429 Too Many Requests"), false},
+		{"rate limit", errors.New("rate limit exceeded"), false},
+		{"too many results", errors.New("query returned more than 10000 results"), true},
+		{"limit exceeded", errors.New("Log response size exceeded"), true},
+		{"block range", errors.New("block range is too wide"), true},
+		{"other", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRangeTooLarge(tt.err); got != tt.want {
+				t.Errorf("isRangeTooLarge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
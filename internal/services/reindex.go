@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Reindex re-runs the deposit filter over a historical block range.
+// Deposits are deduplicated on txid and log index, missing deposits are stored as ignored so that no drip is given for them,
+// and the live sync cursor is left untouched. The transactions whose stored deposits can't be matched with their events
+// are skipped and reported, they are left to the operator.
+func (s *DataSync) Reindex(basectx context.Context, fromHeight, toHeight uint64) error {
+	if fromHeight > toHeight {
+		return errors.New("Reindex: from height is greater than to height")
+	}
+
+	var total int
+	var skipped []string
+	for startHeight := fromHeight; startHeight <= toHeight; {
+		endHeight := startHeight + s.RangeSync
+		if endHeight > toHeight {
+			endHeight = toHeight
+		}
+
+		count, txids, err := s.reindexRange(basectx, startHeight, endHeight)
+		if err != nil {
+			return err
+		}
+		total += count
+		skipped = append(skipped, txids...)
+		startHeight = endHeight + 1
+	}
+
+	logrus.Infof("Reindex done: %d missing deposits from %d to %d", total, fromHeight, toHeight)
+	if len(skipped) > 0 {
+		logrus.Warnf("Reindex skipped %d txs whose stored deposits don't match their events: %s", len(skipped), strings.Join(skipped, ","))
+	}
+	return nil
+}
+
+func (s *DataSync) reindexRange(basectx context.Context, startHeight, endHeight uint64) (int, []string, error) {
+	logrus.Infof("Reindexing from %d to %d", startHeight, endHeight)
+
+	newctx, cancel := context.WithTimeout(basectx, time.Minute)
+	defer cancel()
+
+	deposits, err := s.fetchDeposits(newctx, startHeight, endHeight)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reindexRange: %w", err)
+	}
+	for _, item := range deposits {
+		item.Status = repository.DepositStatusIgnore
+	}
+
+	count, skipped, err := s.Repositroy.SaveReindexedDeposits(newctx, deposits)
+	if err != nil {
+		return 0, nil, fmt.Errorf("reindexRange: %w", err)
+	}
+	return count, skipped, nil
+}
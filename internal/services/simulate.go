@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SimDeposit is a historical deposit to replay, with the metadata of its token and the drip it actually got
+type SimDeposit struct {
+	Deposit  *repository.Deposit
+	Decimals uint8
+	Standard bool
+	// TokenL1 is the L1 token the L2 token is bridged from, the deposits of another L1 token are skipped.
+	// Empty means unknown and the L1 token of the deposit is trusted.
+	TokenL1 string
+	// Dripped is the Metis amount actually given, 0 if there was no drip
+	Dripped float64
+	// DrippedAt is the time of the actual drip, the time of the deposit is used if zero
+	DrippedAt time.Time
+}
+
+// processedAt is when the faucet processed the deposit, the simulated drip is stamped with it
+func (d *SimDeposit) processedAt() time.Time {
+	if !d.DrippedAt.IsZero() {
+		return d.DrippedAt
+	}
+	return d.Deposit.CreatedAt
+}
+
+// SimTier gives Drip Metis to a deposit worth at least MinUSD
+type SimTier struct {
+	MinUSD float64 `json:"minusd"`
+	Drip   float64 `json:"drip"`
+}
+
+// SimConfig is a candidate config of the eligibility rules, the addresses are lowercase
+type SimConfig struct {
+	DripHeight uint64
+	MinUSD     float64
+	DripAmount float64
+	// Tiers give more Metis to larger deposits, a deposit gets the drip of the highest tier it reaches,
+	// or DripAmount if it reaches none. They are only used by the simulation.
+	Tiers      []SimTier
+	Allow      map[string]bool
+	Deny       map[string]bool
+	FromLimit  int
+	FromWindow time.Duration
+	// Network gives the stable tokens, which are worth 1 USD without a price
+	Network *utils.Network
+	// Prices are read for the tokens without a recorded price, nil means their deposits are skipped.
+	// They are the current prices rather than the ones at the time of the deposits.
+	Prices utils.Uniswaper
+}
+
+// SimAccount is the state of a receiver, the receivers without a state are fresh EOAs
+type SimAccount struct {
+	Balance  float64 `json:"balance"`
+	Contract bool    `json:"contract"`
+	Nonce    uint64  `json:"nonce"`
+}
+
+// SimState is the recorded or mocked chain state the rules are evaluated against, the addresses are lowercase
+type SimState struct {
+	// Prices are the USD prices by L1 token, the other tokens are priced by SimConfig.Prices
+	Prices   map[string]float64    `json:"prices"`
+	Accounts map[string]SimAccount `json:"accounts"`
+	// Dripped are the receivers which got a drip before the replayed deposits
+	Dripped map[string]bool `json:"dripped"`
+}
+
+// SimReport compares the drips of the candidate config with the drips actually given
+type SimReport struct {
+	Deposits    int
+	Drips       int
+	Metis       float64
+	ActualDrips int
+	ActualMetis float64
+	// Gained and Lost count the deposits which get a drip only under the candidate config, or only in history
+	Gained int
+	Lost   int
+	// Skipped counts the skipped deposits by reason
+	Skipped map[string]int
+}
+
+// SimReason is a skip reason of the simulation and its count
+type SimReason struct {
+	Reason string
+	Count  int
+}
+
+// SkippedReasons returns the skip reasons, the most frequent first
+func (r *SimReport) SkippedReasons() []SimReason {
+	var reasons []SimReason
+	for reason, count := range r.Skipped {
+		reasons = append(reasons, SimReason{Reason: reason, Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+	return reasons
+}
+
+// errNoPrice is returned by simPrices for a token without a recorded price and without a price source
+var errNoPrice = errors.New("no price")
+
+// Simulate replays the deposits in order under the config. It runs the checks of the faucet against
+// the recorded state and has no side effects. The sybil limits only count the drips given in the simulation,
+// which are stamped with the time of the actual drip, the receivers of the state have got a drip before.
+func Simulate(ctx context.Context, config SimConfig, state SimState, deposits []*SimDeposit) (*SimReport, error) {
+	var report = &SimReport{Skipped: make(map[string]int)}
+	var repo = newSimRepository(config, state)
+	var prices = &simPrices{recorded: state.Prices, source: config.Prices, cache: make(map[string]float64)}
+	var client = &simWeb3{accounts: make(map[common.Address]SimAccount)}
+	for address, account := range state.Accounts {
+		client.accounts[common.HexToAddress(address)] = account
+	}
+	var network = config.Network
+	if network == nil {
+		network = &utils.Network{}
+	}
+	var faucet = &Faucet{
+		Network:    network,
+		Web3Client: client,
+		Repositroy: repo,
+		Uniswap:    prices,
+		Tokens:     NewTokens(client, repo),
+		DripHeight: config.DripHeight,
+		MinUSD:     config.MinUSD,
+		FromLimit:  config.FromLimit,
+		FromWindow: config.FromWindow,
+	}
+
+	for _, item := range deposits {
+		report.Deposits++
+		if item.Dripped > 0 {
+			report.ActualDrips++
+			report.ActualMetis += item.Dripped
+		}
+
+		// the deposit is copied, the checks record the check mode in it
+		deposit := *item.Deposit
+		deposit.To, deposit.From = strings.ToLower(deposit.To), strings.ToLower(deposit.From)
+		deposit.L1Token, deposit.L2Token = strings.ToLower(deposit.L1Token), strings.ToLower(deposit.L2Token)
+
+		// the token of the deposit is its recorded metadata, the l1 token of the deposit is trusted if unknown
+		var token = &repository.Token{Address: deposit.L2Token, L1Token: strings.ToLower(item.TokenL1), Decimals: item.Decimals, Standard: item.Standard, CheckedAt: time.Now()}
+		if token.L1Token == "" {
+			token.L1Token = deposit.L1Token
+		}
+		faucet.Tokens.tokens[deposit.L2Token] = token
+		repo.now = item.processedAt()
+
+		reason, err := simulateChecks(ctx, faucet, &deposit)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			report.Skipped[reason]++
+			if item.Dripped > 0 {
+				report.Lost++
+			}
+			continue
+		}
+
+		// the price is cached by the checks
+		var rate float64 = 1
+		if !network.IsStableL2Token(deposit.L2Token) {
+			if rate, err = prices.GetTokenPrice(ctx, deposit.L1Token); err != nil {
+				return nil, err
+			}
+		}
+		amount := config.dripAmount(rate * deposit.Amount.Readable(int64(item.Decimals)))
+
+		repo.dripped[deposit.To] = true
+		repo.drips = append(repo.drips, simDrip{from: deposit.From, at: repo.now})
+		report.Drips++
+		report.Metis += amount
+		if item.Dripped == 0 {
+			report.Gained++
+		}
+	}
+	return report, nil
+}
+
+// simulateChecks returns the reason to skip the deposit, every deposit is a batch of its own,
+// the receivers dripped before are found by HasGotDrip
+func simulateChecks(ctx context.Context, faucet *Faucet, deposit *repository.Deposit) (string, error) {
+	allowlisted, err := faucet.shouldTransfer(ctx, deposit)
+	if err == nil {
+		err = faucet.shouldTransferInOrder(ctx, deposit, allowlisted, make(map[string]bool))
+	}
+	var skip ErrorNoNeedToTransfer
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.As(err, &skip):
+		return skip.Reason(), nil
+	case errors.Is(err, errNoPrice):
+		return errNoPrice.Error(), nil
+	}
+	return "", err
+}
+
+func (c *SimConfig) dripAmount(value float64) float64 {
+	var amount, reached = c.DripAmount, -1.0
+	for _, tier := range c.Tiers {
+		if value >= tier.MinUSD && tier.MinUSD > reached {
+			amount, reached = tier.Drip, tier.MinUSD
+		}
+	}
+	return amount
+}
+
+type simDrip struct {
+	from string
+	at   time.Time
+}
+
+// simRepository answers the checks of the faucet from the config and the drips of the simulation.
+// It embeds FaucetRepository for the methods the checks don't use, they are never called.
+type simRepository struct {
+	FaucetRepository
+
+	lists   map[string]*repository.AddressListEntry
+	dripped map[string]bool
+	drips   []simDrip
+	// now is the clock of the simulation, the time the deposit is processed
+	now time.Time
+}
+
+func newSimRepository(config SimConfig, state SimState) *simRepository {
+	var repo = &simRepository{lists: make(map[string]*repository.AddressListEntry), dripped: make(map[string]bool)}
+	for address := range config.Allow {
+		repo.lists[address] = &repository.AddressListEntry{Address: address, Kind: repository.AddressListAllow}
+	}
+	// an address in both lists is denied like by the unique entry of the address list
+	for address := range config.Deny {
+		repo.lists[address] = &repository.AddressListEntry{Address: address, Kind: repository.AddressListDeny}
+	}
+	for address, dripped := range state.Dripped {
+		repo.dripped[address] = dripped
+	}
+	return repo
+}
+
+func (r *simRepository) ChainId() uint64 {
+	return 0
+}
+
+func (r *simRepository) GetAddressListEntry(ctx context.Context, address string) (*repository.AddressListEntry, error) {
+	return r.lists[address], nil
+}
+
+func (r *simRepository) HasGotDrip(ctx context.Context, address string, pid uint64) (bool, error) {
+	return !r.dripped[address], nil
+}
+
+func (r *simRepository) CountDripsByFrom(ctx context.Context, from string, within time.Duration) (int, error) {
+	var count int
+	for _, item := range r.drips {
+		if item.from == from && !item.at.Before(r.now.Add(-within)) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// simWeb3 answers the account state of the receivers from the recorded state, the others are fresh EOAs.
+// It embeds Web3Client for the methods the checks don't use, they are never called.
+type simWeb3 struct {
+	Web3Client
+
+	accounts map[common.Address]SimAccount
+}
+
+func (c *simWeb3) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return utils.ToWei(c.accounts[account].Balance), nil
+}
+
+func (c *simWeb3) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	if c.accounts[account].Contract {
+		return []byte{0x1}, nil
+	}
+	return nil, nil
+}
+
+func (c *simWeb3) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return c.accounts[account].Nonce, nil
+}
+
+// simPrices returns the recorded prices, the others are read once from the source
+type simPrices struct {
+	recorded map[string]float64
+	source   utils.Uniswaper
+	cache    map[string]float64
+}
+
+func (p *simPrices) GetTokenPrice(ctx context.Context, token string) (float64, error) {
+	token = strings.ToLower(token)
+	if price, ok := p.recorded[token]; ok {
+		return price, nil
+	}
+	if price, ok := p.cache[token]; ok {
+		return price, nil
+	}
+	if p.source == nil {
+		return 0, errNoPrice
+	}
+	price, err := p.source.GetTokenPrice(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	p.cache[token] = price
+	return price, nil
+}
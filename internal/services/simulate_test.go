@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+)
+
+// simAddress returns the address numbered n, senders are numbered from 0xf0
+func simAddress(n int) string {
+	return fmt.Sprintf("0x%040x", n)
+}
+
+func newSimDeposit(id uint64, from, to int, amount int64, dripped float64) *SimDeposit {
+	return &SimDeposit{
+		Deposit: &repository.Deposit{
+			Id:        id,
+			Height:    1000,
+			L1Token:   testL1Token,
+			L2Token:   testL2Token,
+			From:      simAddress(from),
+			To:        simAddress(to),
+			Amount:    bigint.FromBigInt(new(big.Int).Mul(big.NewInt(amount), big.NewInt(1e18))),
+			CreatedAt: time.Unix(int64(id)*3600, 0),
+		},
+		Decimals: 18,
+		Standard: true,
+		Dripped:  dripped,
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	const denied, allowed, used = 0xd, 0xe, 0x5
+	config := SimConfig{
+		DripHeight: 100,
+		MinUSD:     100,
+		DripAmount: 0.01,
+		Tiers:      []SimTier{{MinUSD: 1000, Drip: 0.05}},
+		Deny:       map[string]bool{simAddress(denied): true},
+		Allow:      map[string]bool{simAddress(allowed): true},
+		FromLimit:  1,
+		FromWindow: time.Hour * 24,
+	}
+	state := SimState{
+		Prices:   map[string]float64{testL1Token: 2},
+		Accounts: map[string]SimAccount{simAddress(used): {Nonce: 1}, simAddress(allowed): {Balance: 1}},
+	}
+	deposits := []*SimDeposit{
+		newSimDeposit(1, 0xf1, 0xa, 100, 0.01),     // 200 usd
+		newSimDeposit(2, 0xf2, 0xa, 100, 0),        // dripped in the simulation before
+		newSimDeposit(3, 0xf3, denied, 100, 0.01),  // lost
+		newSimDeposit(4, 0xf4, 0xb, 10, 0),         // 20 usd
+		newSimDeposit(5, 0xf1, 0xc, 100, 0),        // sender limit
+		newSimDeposit(6, 0xf6, used, 100, 0),       // nonce
+		newSimDeposit(7, 0xf1, allowed, 1000, 0),   // allowlisted, 2000 usd tier, gained
+		newSimDeposit(8, 0xf8, 0xf, 100, 0),        // below the drip height
+		newSimDeposit(9, 0xf9, 0x10, 100, 0.01),    // not standard, lost
+		newSimDeposit(10, 0xfa, 0x11, 100, 0.01),   // kept
+		newSimDeposit(11, 0xfb, 0x12, 100000, 0.0), // 200000 usd tier, gained
+	}
+	deposits[7].Deposit.Height = 50
+	deposits[8].Standard = false
+
+	report, err := Simulate(context.Background(), config, state, deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deposits != 11 || report.Drips != 4 || report.ActualDrips != 4 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if math.Abs(report.Metis-0.12) > 1e-9 || math.Abs(report.ActualMetis-0.04) > 1e-9 {
+		t.Errorf("metis = %f, actual = %f, want 0.12 and 0.04", report.Metis, report.ActualMetis)
+	}
+	if report.Gained != 2 || report.Lost != 2 {
+		t.Errorf("gained = %d, lost = %d, want 2 and 2", report.Gained, report.Lost)
+	}
+	for reason, want := range map[string]int{
+		"transfered before":           1,
+		"denylisted":                  1,
+		"amount < min usd":            1,
+		"sender drip limit":           1,
+		"nonce > 0":                   1,
+		"height < dripHeight":         1,
+		"not a standard bridge token": 1,
+	} {
+		if got := report.Skipped[reason]; got != want {
+			t.Errorf("skipped %q = %d, want %d", reason, got, want)
+		}
+	}
+}
+
+func TestSimulate_NoPrice(t *testing.T) {
+	const stableToken = "0x00000000000000000000000000000000000000cc"
+	config := SimConfig{MinUSD: 1, DripAmount: 0.01, Network: &utils.Network{StableL2Tokens: []string{stableToken}}}
+	stable := newSimDeposit(1, 0xf1, 0xa, 10, 0)
+	stable.Deposit.L2Token = "0x00000000000000000000000000000000000000CC"
+
+	report, err := Simulate(context.Background(), config, SimState{}, []*SimDeposit{stable, newSimDeposit(2, 0xf2, 0xb, 10, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drips != 1 || report.Skipped["no price"] != 1 {
+		t.Errorf("a stable token needs no price, got %+v", report)
+	}
+}
+
+// countingPrices prices every token at 1 USD and counts the lookups
+type countingPrices struct {
+	calls int
+}
+
+func (p *countingPrices) GetTokenPrice(ctx context.Context, token string) (float64, error) {
+	p.calls++
+	return 1, nil
+}
+
+func TestSimulate_PriceSource(t *testing.T) {
+	prices := &countingPrices{}
+	config := SimConfig{MinUSD: 1, DripAmount: 0.01, Prices: prices}
+
+	deposits := []*SimDeposit{newSimDeposit(1, 0xf1, 0xa, 10, 0), newSimDeposit(2, 0xf2, 0xb, 10, 0)}
+	report, err := Simulate(context.Background(), config, SimState{}, deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drips != 2 || prices.calls != 1 {
+		t.Errorf("drips = %d after %d price lookups, want the tokens without a recorded price read once", report.Drips, prices.calls)
+	}
+}
+
+func TestSimulate_FromWindowDripTime(t *testing.T) {
+	config := SimConfig{MinUSD: 1, DripAmount: 0.01, FromLimit: 1, FromWindow: time.Hour}
+	state := SimState{Prices: map[string]float64{testL1Token: 1}}
+
+	// the first deposit is dripped 50 minutes after it, the second deposit is 90 minutes after the first one
+	first := newSimDeposit(1, 0xf1, 0xa, 10, 0.01)
+	first.DrippedAt = first.Deposit.CreatedAt.Add(time.Minute * 50)
+	second := newSimDeposit(2, 0xf1, 0xb, 10, 0)
+	second.Deposit.CreatedAt = first.Deposit.CreatedAt.Add(time.Minute * 90)
+
+	report, err := Simulate(context.Background(), config, state, []*SimDeposit{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drips != 1 || report.Skipped["sender drip limit"] != 1 {
+		t.Errorf("the window should be measured from the drip, got %+v", report)
+	}
+}
+
+func TestSimulate_L1TokenAndHistory(t *testing.T) {
+	config := SimConfig{MinUSD: 1, DripAmount: 0.01}
+	state := SimState{Prices: map[string]float64{testL1Token: 1}, Dripped: map[string]bool{simAddress(0xa): true}}
+
+	mismatch := newSimDeposit(2, 0xf2, 0xb, 10, 0)
+	mismatch.TokenL1 = "0x00000000000000000000000000000000000000ee"
+	matched := newSimDeposit(3, 0xf3, 0xc, 10, 0)
+	matched.TokenL1 = "0x0000000000000000000000000000000000000101"
+
+	report, err := Simulate(context.Background(), config, state, []*SimDeposit{newSimDeposit(1, 0xf1, 0xa, 10, 0), mismatch, matched})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drips != 1 || report.Skipped["transfered before"] != 1 || report.Skipped["l1Token mismatch"] != 1 {
+		t.Errorf("the receivers dripped before and the mismatched l1 tokens should be skipped, got %+v", report)
+	}
+}
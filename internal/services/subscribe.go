@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Subscribe syncs with new head and deposit event subscriptions until the context is done.
+// It resubscribes after any failure and catches up from the stored height with the range sync.
+func (s *DataSync) Subscribe(basectx context.Context) error {
+	for {
+		err := s.subscribe(basectx)
+		if basectx.Err() != nil {
+			return nil
+		}
+		logrus.Errorf("subscription fail: %s", err)
+
+		select {
+		case <-basectx.Done():
+			return nil
+		case <-time.After(time.Second * 5):
+		}
+	}
+}
+
+func (s *DataSync) subscribe(basectx context.Context) error {
+	ctx, cancel := context.WithCancel(basectx)
+	defer cancel()
+
+	heads := make(chan *types.Header, 16)
+	headSub, err := s.Web3Client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("subscribe new head: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	events := make(chan *metisl2.L2StandardBridgeDepositFinalized, 16)
+	eventSub, err := s.Bridge.WatchDepositFinalized(&bind.WatchOpts{Context: ctx}, events, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("watch deposit event: %w", err)
+	}
+	defer eventSub.Unsubscribe()
+
+	// subscribe before catching up so that nothing in between is missed
+	if err := s.tryToSync(ctx); err != nil {
+		return err
+	}
+	logrus.Info("subscribed to new heads and deposit events")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-headSub.Err():
+			return fmt.Errorf("new head subscription: %v", err)
+		case err := <-eventSub.Err():
+			return fmt.Errorf("deposit event subscription: %v", err)
+		case head := <-heads:
+			if err := s.syncTo(ctx, head.Number.Uint64()); err != nil {
+				return err
+			}
+		case event := <-events:
+			if event.Raw.Removed {
+				continue
+			}
+			if err := s.saveEvent(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// saveEvent stores a watched deposit ahead of the range sync, which skips it later by the txid and log index
+func (s *DataSync) saveEvent(basectx context.Context, event *metisl2.L2StandardBridgeDepositFinalized) error {
+	newctx, cancel := context.WithTimeout(basectx, time.Second*10)
+	defer cancel()
+
+	deposits := []*repository.Deposit{s.formatEvent(event)}
+	if err := s.Repositroy.SaveDeposits(newctx, deposits, depositsIndexed(deposits)...); err != nil {
+		return fmt.Errorf("saveEvent: %w", err)
+	}
+	s.notify(deposits)
+	deposit := deposits[0]
+	logrus.Infof("New deposit to %s at %d [ Tx %s ]", deposit.To, deposit.Height, deposit.Txid)
+	return nil
+}
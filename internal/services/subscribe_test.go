@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// subscribeWeb3 pushes the heads and the watched logs sent by the test, fail ends the head subscription
+type subscribeWeb3 struct {
+	logsWeb3
+
+	mu     sync.Mutex
+	head   uint64
+	heads  chan *types.Header
+	events chan types.Log
+	fail   chan error
+}
+
+func newSubscribeWeb3(head uint64, logs ...types.Log) *subscribeWeb3 {
+	return &subscribeWeb3{
+		logsWeb3: logsWeb3{logs: logs},
+		head:     head,
+		heads:    make(chan *types.Header),
+		events:   make(chan types.Log),
+		fail:     make(chan error),
+	}
+}
+
+// mine moves the head with the logs of the new blocks
+func (f *subscribeWeb3) mine(head uint64, logs ...types.Log) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head = head
+	f.logs = append(f.logs, logs...)
+}
+
+func (f *subscribeWeb3) BlockNumber(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.head, nil
+}
+
+func (f *subscribeWeb3) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: number, Difficulty: big.NewInt(0)}, nil
+}
+
+func (f *subscribeWeb3) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logsWeb3.FilterLogs(ctx, query)
+}
+
+func (f *subscribeWeb3) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for {
+			select {
+			case <-quit:
+				return nil
+			case err := <-f.fail:
+				return err
+			case head := <-f.heads:
+				ch <- head
+			}
+		}
+	}), nil
+}
+
+func (f *subscribeWeb3) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		for {
+			select {
+			case <-quit:
+				return nil
+			case item := <-f.events:
+				ch <- item
+			}
+		}
+	}), nil
+}
+
+// subscribeRepository stores the deposits once by txid and log index and moves the cursor
+type subscribeRepository struct {
+	SyncRepository
+
+	mu       sync.Mutex
+	tail     uint64
+	deposits map[string]*repository.Deposit
+	watched  int
+}
+
+func (f *subscribeRepository) save(deposits []*repository.Deposit) {
+	if f.deposits == nil {
+		f.deposits = make(map[string]*repository.Deposit)
+	}
+	for _, item := range deposits {
+		f.deposits[fmt.Sprintf("%s:%d", item.Txid, item.LogIndex.Int64)] = item
+	}
+}
+
+func (f *subscribeRepository) SaveSyncedData(ctx context.Context, deposits []*repository.Deposit, tail *repository.Height, events ...*repository.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.save(deposits)
+	f.tail = tail.Number
+	return nil
+}
+
+func (f *subscribeRepository) SaveDeposits(ctx context.Context, deposits []*repository.Deposit, events ...*repository.OutboxEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.save(deposits)
+	f.watched++
+	return nil
+}
+
+// state returns the cursor, the count of the deposits and the count of the watched ones
+func (f *subscribeRepository) state() (uint64, int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tail, len(f.deposits), f.watched
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second * 5); !cond(); time.Sleep(time.Millisecond * 5) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestDataSync_SubscribeReconnect(t *testing.T) {
+	client := newSubscribeWeb3(30, newDepositLog(t, 10, common.HexToHash("0x01"), 0, common.HexToAddress("0x11")))
+	bridge, err := metisl2.NewL2StandardBridge(common.HexToAddress("0x4200000000000000000000000000000000000010"), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &subscribeRepository{}
+	s := &DataSync{Network: &utils.Network{}, Web3Client: client, Bridge: bridge, Repositroy: repo, RangeSync: 20}
+	s.ranger = newAdaptiveRange(s.RangeSync, 5000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- s.subscribe(ctx) }()
+
+	// the blocks before the subscription are caught up with the range sync
+	waitFor(t, "the catch up", func() bool {
+		tail, count, _ := repo.state()
+		return tail == 30 && count == 1
+	})
+
+	// a watched deposit is stored ahead of the range sync of its head, which stores it once
+	deposit := newDepositLog(t, 31, common.HexToHash("0x02"), 0, common.HexToAddress("0x12"))
+	client.events <- deposit
+	client.mine(35, deposit)
+	client.heads <- &types.Header{Number: big.NewInt(35)}
+	waitFor(t, "the new head", func() bool {
+		tail, count, watched := repo.state()
+		return tail == 35 && count == 2 && watched == 1
+	})
+
+	client.fail <- errors.New("connection reset")
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "new head subscription") {
+			t.Fatalf("subscribe() = %v, want the head subscription error", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscribe() should return after the subscription fails")
+	}
+
+	// the deposits mined while disconnected are caught up after resubscribing
+	client.mine(50, newDepositLog(t, 45, common.HexToHash("0x03"), 0, common.HexToAddress("0x13")))
+	go func() { errc <- s.subscribe(ctx) }()
+	waitFor(t, "the catch up after resubscribing", func() bool {
+		tail, count, _ := repo.state()
+		return tail == 50 && count == 3
+	})
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("subscribe() = %v after the shutdown, want context.Canceled", err)
+	}
+	if s.height != 51 {
+		t.Errorf("height = %d, want 51", s.height)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// tokenRecheckInterval is how long a non-standard verdict is trusted before the token contract is read again
+const tokenRecheckInterval = time.Hour * 6
+
+// TokenRepository is the part of repository.Metis used by Tokens
+type TokenRepository interface {
+	ChainId() uint64
+	GetToken(ctx context.Context, address string) (*repository.Token, error)
+	SaveToken(ctx context.Context, token *repository.Token) error
+}
+
+// Tokens caches the metadata of L2 tokens in memory and in the tokens table,
+// the metadata of a standard token is read from the token contract only once,
+// a non-standard one is read again after tokenRecheckInterval
+type Tokens struct {
+	Web3Client Web3Client
+	Repositroy TokenRepository
+
+	mu     sync.Mutex
+	tokens map[string]*repository.Token
+}
+
+func NewTokens(client Web3Client, repo TokenRepository) *Tokens {
+	return &Tokens{Web3Client: client, Repositroy: repo, tokens: make(map[string]*repository.Token)}
+}
+
+func (t *Tokens) Get(basectx context.Context, address string) (*repository.Token, error) {
+	address = strings.ToLower(address)
+
+	t.mu.Lock()
+	token, ok := t.tokens[address]
+	t.mu.Unlock()
+	if ok && !needRecheck(token) {
+		return token, nil
+	}
+
+	newctx, cancel := context.WithTimeout(basectx, time.Second*10)
+	defer cancel()
+
+	token, err := t.Repositroy.GetToken(newctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || needRecheck(token) {
+		if token, err = t.fetch(newctx, address); err != nil {
+			return nil, err
+		}
+		if err := t.Repositroy.SaveToken(newctx, token); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	t.tokens[address] = token
+	t.mu.Unlock()
+	return token, nil
+}
+
+// needRecheck tells whether the non-standard verdict of the token has expired
+func needRecheck(token *repository.Token) bool {
+	return !token.Standard && time.Since(token.CheckedAt) > tokenRecheckInterval
+}
+
+// fetch reads the metadata from the token contract, a call reverted by the contract
+// marks the token as non-standard instead of failing. Any other error, such as an empty
+// result from a lagging endpoint, fails the fetch so that nothing is saved.
+func (t *Tokens) fetch(ctx context.Context, address string) (*repository.Token, error) {
+	l2token, err := metisl2.NewL2StandardERC20Caller(common.HexToAddress(address), t.Web3Client)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts = &bind.CallOpts{Context: ctx}
+	var token = &repository.Token{ChainId: t.Repositroy.ChainId(), Address: address, Standard: true, CheckedAt: time.Now()}
+	var check = func(method string, err error) error {
+		if err == nil {
+			return nil
+		}
+		if isCallReverted(err) {
+			token.Standard = false
+			return nil
+		}
+		return fmt.Errorf("get %s of %s: %w", method, address, err)
+	}
+
+	supported, err := l2token.SupportsInterface(opts, l2StandardERC20InterfaceId)
+	if err := check("supportsInterface", err); err != nil {
+		return nil, err
+	}
+	token.Standard = token.Standard && supported
+
+	l1token, err := l2token.L1Token(opts)
+	if err := check("l1Token", err); err != nil {
+		return nil, err
+	}
+	token.L1Token = strings.ToLower(l1token.Hex())
+
+	token.Decimals, err = l2token.Decimals(opts)
+	if err := check("decimals", err); err != nil {
+		return nil, err
+	}
+	token.Symbol, err = l2token.Symbol(opts)
+	if err := check("symbol", err); err != nil {
+		return nil, err
+	}
+	token.Name, err = l2token.Name(opts)
+	if err := check("name", err); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// l2StandardERC20InterfaceId is the ERC165 interface id of IL2StandardERC20,
+// l1Token.selector ^ mint.selector ^ burn.selector
+var l2StandardERC20InterfaceId = interfaceId("l1Token()", "mint(address,uint256)", "burn(address,uint256)")
+
+func interfaceId(signatures ...string) (id [4]byte) {
+	for _, signature := range signatures {
+		selector := crypto.Keccak256([]byte(signature))
+		for i := range id {
+			id[i] ^= selector[i]
+		}
+	}
+	return
+}
+
+// isCallReverted tells whether a contract call was explicitly reverted by the contract.
+// No code and empty results are not, an endpoint behind the chain head returns them too.
+func isCallReverted(err error) bool {
+	return strings.Contains(err.Error(), "execution reverted")
+}
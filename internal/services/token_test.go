@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestL2StandardERC20InterfaceId(t *testing.T) {
+	if want := [4]byte{0x1d, 0x1d, 0x8b, 0x63}; l2StandardERC20InterfaceId != want {
+		t.Errorf("interface id = %x, want %x", l2StandardERC20InterfaceId, want)
+	}
+	if want := [4]byte{0x01, 0xff, 0xc9, 0xa7}; interfaceId("supportsInterface(bytes4)") != want {
+		t.Errorf("ERC165 interface id = %x, want %x", interfaceId("supportsInterface(bytes4)"), want)
+	}
+}
+
+func TestIsCallReverted(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{bind.ErrNoCode, false},
+		{fmt.Errorf("call: %w", bind.ErrNoCode), false},
+		{errors.New("execution reverted"), true},
+		{errors.New("execution reverted: not supported"), true},
+		{errors.New("abi: attempting to unmarshall an empty string while arguments are expected"), false},
+		{errors.New("dial tcp: connection refused"), false},
+		{errors.New("context deadline exceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := isCallReverted(tt.err); got != tt.want {
+			t.Errorf("isCallReverted(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestNeedRecheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		token repository.Token
+		want  bool
+	}{
+		{"standard", repository.Token{Standard: true, CheckedAt: time.Now().Add(-tokenRecheckInterval * 2)}, false},
+		{"fresh verdict", repository.Token{CheckedAt: time.Now()}, false},
+		{"expired verdict", repository.Token{CheckedAt: time.Now().Add(-tokenRecheckInterval * 2)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needRecheck(&tt.token); got != tt.want {
+				t.Errorf("needRecheck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// tokenWeb3 answers the calls of a standard token, revert names the method reverted by the contract
+type tokenWeb3 struct {
+	fakeWeb3
+
+	abi    abi.ABI
+	revert string
+	err    error
+	calls  int
+}
+
+func newTokenWeb3(t *testing.T) *tokenWeb3 {
+	parsed, err := abi.JSON(strings.NewReader(metisl2.L2StandardERC20MetaData.ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tokenWeb3{abi: parsed}
+}
+
+func (f *tokenWeb3) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	method, err := f.abi.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if method.Name == f.revert {
+		return nil, errors.New("execution reverted")
+	}
+	var results = map[string]interface{}{
+		"supportsInterface": true,
+		"l1Token":           common.HexToAddress(testL1Token),
+		"decimals":          uint8(18),
+		"symbol":            "TEST",
+		"name":              "Test Token",
+	}
+	return method.Outputs.Pack(results[method.Name])
+}
+
+// fakeTokenRepository keeps the tokens table in memory and counts the reads
+type fakeTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*repository.Token
+	reads  int
+	saves  int
+}
+
+func (f *fakeTokenRepository) ChainId() uint64 {
+	return 1088
+}
+
+func (f *fakeTokenRepository) GetToken(ctx context.Context, address string) (*repository.Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	if token, ok := f.tokens[address]; ok {
+		copied := *token
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeTokenRepository) SaveToken(ctx context.Context, token *repository.Token) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tokens == nil {
+		f.tokens = make(map[string]*repository.Token)
+	}
+	f.saves++
+	copied := *token
+	f.tokens[token.Address] = &copied
+	return nil
+}
+
+func TestTokens_LazyFill(t *testing.T) {
+	client, repo := newTokenWeb3(t), &fakeTokenRepository{}
+	tokens := NewTokens(client, repo)
+
+	// the first lookup reads the contract and saves the token, the next ones hit the memory
+	for i := 0; i < 2; i++ {
+		token, err := tokens.Get(context.Background(), common.HexToAddress(testL2Token).Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !token.Standard || token.L1Token != testL1Token || token.Decimals != 18 || token.Symbol != "TEST" || token.Address != testL2Token {
+			t.Fatalf("unexpected token %+v", token)
+		}
+	}
+	if client.calls != 5 || repo.reads != 1 || repo.saves != 1 {
+		t.Errorf("calls %d reads %d saves %d, want the token read and saved once", client.calls, repo.reads, repo.saves)
+	}
+
+	// a restarted faucet reads the saved token from the table
+	tokens = NewTokens(client, repo)
+	if _, err := tokens.Get(context.Background(), testL2Token); err != nil {
+		t.Fatal(err)
+	}
+	if client.calls != 5 || repo.reads != 2 {
+		t.Errorf("calls %d reads %d, want the token read from the table", client.calls, repo.reads)
+	}
+}
+
+func TestTokens_NonStandard(t *testing.T) {
+	client, repo := newTokenWeb3(t), &fakeTokenRepository{}
+	client.revert = "supportsInterface"
+	tokens := NewTokens(client, repo)
+
+	token, err := tokens.Get(context.Background(), testL2Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Standard || repo.saves != 1 {
+		t.Fatalf("token %+v saved %d times, want a non-standard verdict saved", token, repo.saves)
+	}
+
+	// the verdict is read again from the contract once it has expired
+	repo.tokens[testL2Token].CheckedAt = time.Now().Add(-tokenRecheckInterval * 2)
+	client.revert = ""
+	tokens = NewTokens(client, repo)
+	if token, err = tokens.Get(context.Background(), testL2Token); err != nil {
+		t.Fatal(err)
+	}
+	if !token.Standard || repo.saves != 2 || client.calls != 10 {
+		t.Errorf("token %+v saved %d times after %d calls, want the standard verdict saved again", token, repo.saves, client.calls)
+	}
+}
+
+func TestTokens_FetchError(t *testing.T) {
+	client, repo := newTokenWeb3(t), &fakeTokenRepository{}
+	client.err = errors.New("dial tcp: connection refused")
+	tokens := NewTokens(client, repo)
+
+	if _, err := tokens.Get(context.Background(), testL2Token); err == nil {
+		t.Fatal("Get() should fail if the contract can't be read")
+	}
+	if repo.saves != 0 || len(tokens.tokens) != 0 {
+		t.Errorf("saved %d tokens, cached %d, want nothing", repo.saves, len(tokens.tokens))
+	}
+
+	// the next lookup reads the contract again
+	client.err = nil
+	if _, err := tokens.Get(context.Background(), testL2Token); err != nil {
+		t.Fatal(err)
+	}
+	if repo.saves != 1 {
+		t.Errorf("saved %d tokens, want 1", repo.saves)
+	}
+}
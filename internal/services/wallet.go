@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sirupsen/logrus"
+)
+
+// Wallet is a hot wallet of the faucet with its own nonce sequence.
+// It's only used by the faucet loop, so it needs no lock.
+type Wallet struct {
+	Prvkey  *ecdsa.PrivateKey
+	Account common.Address
+
+	nonce   uint64
+	balance *big.Int
+	// failures counts the broadcasts failed in a row
+	failures int
+	// low is set once the wallet low event is emitted, until the balance recovers
+	low bool
+	// refillUntil skips refilling until the last refill should have been mined
+	refillUntil time.Time
+}
+
+func NewWallet(prvkey *ecdsa.PrivateKey) *Wallet {
+	return &Wallet{Prvkey: prvkey, Account: crypto.PubkeyToAddress(prvkey.PublicKey)}
+}
+
+// sync reads the nonce and the balance of the wallet. The nonce is the pending one,
+// so a faucet taking over doesn't sign over the drips of the former leader which are not mined yet.
+func (w *Wallet) sync(ctx context.Context, client Web3Client) (err error) {
+	if w.nonce, err = client.PendingNonceAt(ctx, w.Account); err != nil {
+		return fmt.Errorf("get pending nonce of %s: %w", w.Account, err)
+	}
+	return w.syncBalance(ctx, client)
+}
+
+func (w *Wallet) syncBalance(ctx context.Context, client Web3Client) (err error) {
+	if w.balance, err = client.BalanceAt(ctx, w.Account, nil); err != nil {
+		return fmt.Errorf("get balance of %s: %w", w.Account, err)
+	}
+	return nil
+}
+
+// spend records a transfer sent from the wallet until the balance is read again
+func (w *Wallet) spend(tx *types.Transaction) {
+	w.nonce += 1
+	if w.balance != nil {
+		w.balance = new(big.Int).Sub(w.balance, tx.Cost())
+	}
+}
+
+// pickWallet returns the healthiest wallet which can afford a drip, that is the wallet with the fewest
+// broadcasts failed in a row, then with the most balance. The wallets with drips in flight are skipped,
+// a drip would wait behind them. It's nil if no wallet can afford a drip.
+func (s *Faucet) pickWallet() *Wallet {
+	var picked *Wallet
+	for _, item := range s.Wallets {
+		if item.balance == nil || item.balance.Cmp(s.DripAmount) <= 0 || s.inflight.has(item.Account) {
+			continue
+		}
+		if picked == nil || item.failures < picked.failures ||
+			(item.failures == picked.failures && item.balance.Cmp(picked.balance) > 0) {
+			picked = item
+		}
+	}
+	return picked
+}
+
+func (s *Faucet) makeTransferTx(basectx context.Context, from *Wallet, to common.Address, value *big.Int) (*types.Transaction, error) {
+	newctx, cancel := context.WithTimeout(basectx, time.Second*5)
+	defer cancel()
+
+	gasPrice, err := s.Web3Client.SuggestGasPrice(newctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gas, err := s.Web3Client.EstimateGas(newctx, ethereum.CallMsg{From: from.Account, To: &to, Value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	rawtx := &types.LegacyTx{
+		Nonce:    from.nonce,
+		GasPrice: gasPrice,
+		Gas:      gas,
+		To:       &to,
+		Value:    value,
+	}
+	return types.SignNewTx(from.Prvkey, s.Eip155Signer, rawtx)
+}
+
+// checkWallets reads the balances of the wallets, then emits the wallet low events
+// and refills the wallets from the treasury
+func (s *Faucet) checkWallets(basectx context.Context) error {
+	newctx, cancel := context.WithTimeout(basectx, time.Minute)
+	defer cancel()
+
+	for _, item := range s.Wallets {
+		if err := item.syncBalance(newctx, s.Web3Client); err != nil {
+			return err
+		}
+		// the wallets are watched and refilled by the faucet which broadcasts the drips
+		if s.DryRun {
+			continue
+		}
+		if err := s.checkLowBalance(newctx, item); err != nil {
+			return err
+		}
+		if err := s.refill(newctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLowBalance emits the wallet low event once the balance drops below LowBalance,
+// it's emitted again only after the balance has recovered
+func (s *Faucet) checkLowBalance(ctx context.Context, wallet *Wallet) error {
+	if s.LowBalance <= 0 {
+		return nil
+	}
+
+	balance := utils.ToEther(wallet.balance)
+	if balance >= s.LowBalance {
+		wallet.low = false
+		return nil
+	}
+	if wallet.low {
+		return nil
+	}
+
+	logrus.Warnf("Wallet %s balance %f is lower than %f", wallet.Account, balance, s.LowBalance)
+	payload := walletPayload{Account: wallet.Account.Hex(), Balance: balance, Threshold: s.LowBalance}
+	key := fmt.Sprintf("%s:%s", wallet.Account.Hex(), strconv.FormatInt(time.Now().Unix(), 10))
+	if err := s.Repositroy.AddOutboxEvents(ctx, newEvent(EventWalletLow, key, payload)...); err != nil {
+		return err
+	}
+	wallet.low = true
+	return nil
+}
+
+// refill sends RefillAmount from the treasury to the wallet if its balance is below RefillBelow
+func (s *Faucet) refill(ctx context.Context, wallet *Wallet) error {
+	if s.Treasury == nil || s.RefillBelow == nil || s.RefillAmount == nil {
+		return nil
+	}
+	if wallet.balance.Cmp(s.RefillBelow) >= 0 || time.Now().Before(wallet.refillUntil) {
+		return nil
+	}
+
+	if err := s.Treasury.syncBalance(ctx, s.Web3Client); err != nil {
+		return err
+	}
+	// the treasury may send transactions of its own, so its nonce is read again before each refill
+	nonce, err := s.Web3Client.PendingNonceAt(ctx, s.Treasury.Account)
+	if err != nil {
+		return fmt.Errorf("get pending nonce of %s: %w", s.Treasury.Account, err)
+	}
+	s.Treasury.nonce = nonce
+	if s.Treasury.balance.Cmp(s.RefillAmount) <= 0 {
+		logrus.Warnf("Treasury %s can't refill %s, its balance is %f", s.Treasury.Account, wallet.Account, utils.ToEther(s.Treasury.balance))
+		return nil
+	}
+
+	tx, err := s.makeTransferTx(ctx, s.Treasury, wallet.Account, s.RefillAmount)
+	if err != nil {
+		return err
+	}
+	audit := &repository.AuditLog{
+		Operator: "faucet",
+		Action:   "refill",
+		Target:   wallet.Account.Hex(),
+		Detail:   fmt.Sprintf("%f Metis from %s [ Tx %s ]", utils.ToEther(s.RefillAmount), s.Treasury.Account, tx.Hash()),
+	}
+	if err := s.Repositroy.AddAuditLog(ctx, audit); err != nil {
+		return err
+	}
+	logrus.Infof("Refill: send %f Metis to %s [ Tx %s ]", utils.ToEther(s.RefillAmount), wallet.Account, tx.Hash())
+	if err := s.Web3Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	s.Treasury.spend(tx)
+	wallet.refillUntil = time.Now().Add(time.Minute * 10)
+	return nil
+}
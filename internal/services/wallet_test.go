@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils/bigint"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestFaucet_PickWallet(t *testing.T) {
+	var (
+		poor    = &Wallet{balance: utils.ToWei(0.001)}
+		rich    = &Wallet{balance: utils.ToWei(10)}
+		middle  = &Wallet{balance: utils.ToWei(5)}
+		failing = &Wallet{balance: utils.ToWei(100), failures: 2}
+		unknown = &Wallet{}
+	)
+	tests := []struct {
+		name    string
+		wallets []*Wallet
+		want    *Wallet
+	}{
+		{"most balance", []*Wallet{middle, rich, poor}, rich},
+		{"fewest failures", []*Wallet{failing, middle}, middle},
+		{"only failing", []*Wallet{poor, failing}, failing},
+		{"none affordable", []*Wallet{poor, unknown}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Faucet{Wallets: tt.wallets, DripAmount: utils.ToWei(0.01)}
+			if got := s.pickWallet(); got != tt.want {
+				t.Errorf("pickWallet() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWallet_Spend(t *testing.T) {
+	w := &Wallet{nonce: 3, balance: big.NewInt(1e18)}
+	w.spend(newTestTx(3))
+	if w.nonce != 4 {
+		t.Errorf("nonce = %d, want 4", w.nonce)
+	}
+	// the cost is 21000 gas at 1 wei and the value of 1 wei
+	if want := big.NewInt(1e18 - 21001); w.balance.Cmp(want) != 0 {
+		t.Errorf("balance = %s, want %s", w.balance, want)
+	}
+}
+
+func TestFaucet_RefillPendingNonce(t *testing.T) {
+	prvkey, _ := crypto.GenerateKey()
+	treasury := NewWallet(prvkey)
+	client := &fakeWeb3{
+		balances: map[common.Address]*big.Int{treasury.Account: utils.ToWei(1000)},
+		// the treasury has sent 5 transactions of its own since it was synced
+		pendingNonces: map[common.Address]uint64{treasury.Account: 5},
+	}
+	repo := newFakeRepository()
+	s := newTestFaucet(client, repo)
+	s.Treasury, s.RefillBelow, s.RefillAmount = treasury, utils.ToWei(1), utils.ToWei(10)
+
+	wallet := s.Wallets[0]
+	wallet.balance = utils.ToWei(0.5)
+	if err := s.refill(context.Background(), wallet); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.txs) != 1 || client.txs[0].Nonce() != 5 {
+		t.Fatalf("sent %d refills, want one with the pending nonce 5", len(client.txs))
+	}
+	if treasury.nonce != 6 || len(repo.audits) != 1 {
+		t.Errorf("treasury nonce %d audits %d, want 6 and 1", treasury.nonce, len(repo.audits))
+	}
+}
+
+func TestFaucet_TakeOverPendingNonce(t *testing.T) {
+	deposit := &repository.Deposit{Id: 1, Height: 200, L1Token: testL1Token, L2Token: testL2Token, To: "0x0000000000000000000000000000000000000002", Amount: bigint.FromBigInt(utils.ToWei(1000))}
+	repo := newFakeRepository(deposit)
+	client := &fakeWeb3{}
+	s := newTestFaucet(client, repo)
+
+	// the former leader has 4 drips of the wallet which are not mined yet
+	account := s.Wallets[0].Account
+	client.balances = map[common.Address]*big.Int{account: utils.ToWei(100)}
+	client.nonces = map[common.Address]uint64{account: 3}
+	client.pendingNonces = map[common.Address]uint64{account: 7}
+
+	if err := s.Initial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.tryToSendDrip(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.txs) != 1 || client.txs[0].Nonce() != 7 {
+		t.Fatalf("sent %d drips, want one with the pending nonce 7", len(client.txs))
+	}
+	if s.Wallets[0].nonce != 8 {
+		t.Errorf("nonce = %d, want 8", s.Wallets[0].nonce)
+	}
+}
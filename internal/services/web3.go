@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Web3Client is the chain api of the services, it is implemented by *ethclient.Client and *web3.Pool
+type Web3Client interface {
+	bind.ContractBackend
+
+	ChainID(ctx context.Context) (*big.Int, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// batchCaller is implemented by *web3.Pool, the clients without it make the calls one by one
+type batchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+type accountState struct {
+	balance *big.Int
+	code    []byte
+	nonce   uint64
+}
+
+// getAccountState reads the balance, the code and the nonce of the account at the block, nil means the latest block.
+// They are read in one json-rpc batch if the client supports it.
+func getAccountState(ctx context.Context, client Web3Client, account common.Address, block *big.Int) (*accountState, error) {
+	batcher, ok := client.(batchCaller)
+	if !ok {
+		var state accountState
+		var err error
+		if state.balance, err = client.BalanceAt(ctx, account, block); err != nil {
+			return nil, err
+		}
+		if state.code, err = client.CodeAt(ctx, account, block); err != nil {
+			return nil, err
+		}
+		if state.nonce, err = client.NonceAt(ctx, account, block); err != nil {
+			return nil, err
+		}
+		return &state, nil
+	}
+
+	var number = "latest"
+	if block != nil {
+		number = hexutil.EncodeBig(block)
+	}
+	var balance hexutil.Big
+	var code hexutil.Bytes
+	var nonce hexutil.Uint64
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{account, number}, Result: &balance},
+		{Method: "eth_getCode", Args: []interface{}{account, number}, Result: &code},
+		{Method: "eth_getTransactionCount", Args: []interface{}{account, number}, Result: &nonce},
+	}
+	if err := batcher.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+	for _, item := range batch {
+		if item.Error != nil {
+			return nil, fmt.Errorf("%s: %w", item.Method, item.Error)
+		}
+	}
+	return &accountState{balance: balance.ToInt(), code: code, nonce: uint64(nonce)}, nil
+}
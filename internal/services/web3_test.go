@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type fakeBatcher struct {
+	Web3Client
+	batches [][]rpc.BatchElem
+	fail    string
+	// pruned fails the calls at a block other than the latest
+	pruned bool
+}
+
+func (f *fakeBatcher) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	f.batches = append(f.batches, b)
+	for i := range b {
+		switch result := b[i].Result.(type) {
+		case *hexutil.Big:
+			*result = hexutil.Big(*big.NewInt(7))
+		case *hexutil.Bytes:
+			*result = hexutil.Bytes{0x60}
+		case *hexutil.Uint64:
+			*result = 3
+		}
+		if b[i].Method == f.fail || (f.pruned && b[i].Args[1] != "latest") {
+			b[i].Error = errors.New("failed")
+		}
+	}
+	return nil
+}
+
+func TestGetAccountState_Batch(t *testing.T) {
+	client := &fakeBatcher{}
+	state, err := getAccountState(context.Background(), client, common.HexToAddress("0x1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.batches) != 1 || len(client.batches[0]) != 3 {
+		t.Errorf("the state should be read in one batch of 3 calls, got %d batches", len(client.batches))
+	}
+	if state.balance.Int64() != 7 || len(state.code) != 1 || state.nonce != 3 {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	client = &fakeBatcher{fail: "eth_getCode"}
+	if _, err := getAccountState(context.Background(), client, common.HexToAddress("0x1"), nil); err == nil {
+		t.Error("getAccountState() should fail if a call of the batch fails")
+	}
+}
+
+func TestFaucet_ReceiverState(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive bool
+		pruned  bool
+		want    string
+	}{
+		{"head", false, false, repository.CheckModeHead},
+		{"deposit height", true, false, repository.CheckModeDeposit},
+		{"fallback to head", true, true, repository.CheckModeHead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeBatcher{pruned: tt.pruned}
+			s := &Faucet{Web3Client: client, archive: tt.archive}
+			deposit := &repository.Deposit{To: "0x1", Height: 100}
+			if _, err := s.receiverState(context.Background(), deposit); err != nil {
+				t.Fatal(err)
+			}
+			if deposit.CheckMode != tt.want {
+				t.Errorf("CheckMode = %q, want %q", deposit.CheckMode, tt.want)
+			}
+			if tt.archive && client.batches[0][0].Args[1] != "0x64" {
+				t.Errorf("the state should be read at the deposit height first, got %v", client.batches[0][0].Args[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookSignatureHeader is the hex HMAC-SHA256 of the body keyed by the secret
+	WebhookSignatureHeader = "X-Faucet-Signature"
+	WebhookEventHeader     = "X-Faucet-Event"
+	WebhookDeliveryHeader  = "X-Faucet-Delivery"
+)
+
+// Webhooks delivers the events of the outbox with HTTP POST, retrying with exponential backoff
+type Webhooks struct {
+	Repositroy repository.Metis
+	URL        string
+	Secret     string
+	Client     *http.Client
+
+	// MaxAttempts gives an event up after that many failed attempts
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt, it doubles after each failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type webhookBody struct {
+	Id        uint64          `json:"id"`
+	Event     string          `json:"event"`
+	ChainId   uint64          `json:"chainId"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Run delivers the due events periodically until the context is done
+func (w *Webhooks) Run(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if err := w.Deliver(ctx); err != nil {
+				logrus.Errorf("failed to deliver webhooks: %s", err)
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// Deliver posts the due events once, an event is retried later if its attempt fails
+func (w *Webhooks) Deliver(basectx context.Context) error {
+	newctx, cancel := context.WithTimeout(basectx, time.Minute)
+	defer cancel()
+
+	events, err := w.Repositroy.GetDueWebhookEvents(newctx, 50)
+	if err != nil {
+		return err
+	}
+	for _, item := range events {
+		if err := w.post(newctx, item); err != nil {
+			var giveUp = w.MaxAttempts > 0 && item.Attempts+1 >= w.MaxAttempts
+			var delay = w.retryDelay(item.Attempts)
+			logrus.Warnf("Webhook %s %d attempt %d failed: %s", item.Event, item.Id, item.Attempts+1, err)
+			if err := w.Repositroy.WebhookAttemptFailed(newctx, item.Id, err.Error(), delay, giveUp); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.Repositroy.WebhookDelivered(newctx, item.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryDelay is the delay after the attempts, starting from zero
+func (w *Webhooks) retryDelay(attempts int) time.Duration {
+	var delay = w.Backoff
+	if delay <= 0 {
+		delay = time.Second * 10
+	}
+	for i := 0; i < attempts && (w.MaxBackoff <= 0 || delay < w.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if w.MaxBackoff > 0 && delay > w.MaxBackoff {
+		delay = w.MaxBackoff
+	}
+	return delay
+}
+
+func (w *Webhooks) post(ctx context.Context, event *repository.OutboxEvent) error {
+	body, err := json.Marshal(webhookBody{
+		Id:        event.Id,
+		Event:     event.Event,
+		ChainId:   w.Repositroy.ChainId(),
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(event.Id, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(w.Secret, body))
+
+	var client = w.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the signature of the body, receivers verify it with the shared secret
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
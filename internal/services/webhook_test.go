@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+)
+
+func TestWebhooks_Post(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var requests = make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: body}
+	}))
+	defer receiver.Close()
+
+	w := &Webhooks{Repositroy: repository.NewMetis(nil, 1088), URL: receiver.URL, Secret: "secret"}
+	event := newEvent(EventDripSent, "0xabc", dripPayload{DepositId: 7, Txid: "0xabc", Amount: 0.01})[0]
+	event.Id = 42
+	if err := w.post(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if got, want := req.header.Get(WebhookSignatureHeader), SignWebhook("secret", req.body); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if got := req.header.Get(WebhookEventHeader); got != EventDripSent {
+		t.Errorf("event header = %s", got)
+	}
+	if got := req.header.Get(WebhookDeliveryHeader); got != "42" {
+		t.Errorf("delivery header = %s", got)
+	}
+
+	var body struct {
+		Id      uint64      `json:"id"`
+		Event   string      `json:"event"`
+		ChainId uint64      `json:"chainId"`
+		Data    dripPayload `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Id != 42 || body.Event != EventDripSent || body.ChainId != 1088 || body.Data.DepositId != 7 || body.Data.Txid != "0xabc" {
+		t.Errorf("unexpected body %s", req.body)
+	}
+}
+
+func TestWebhooks_PostFailure(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	w := &Webhooks{URL: receiver.URL, Secret: "secret"}
+	event := &repository.OutboxEvent{Id: 1, Event: EventWalletLow, Payload: []byte("{}")}
+	if err := w.post(context.Background(), event); err == nil {
+		t.Error("post should fail if the receiver doesn't return 2xx")
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '{"id":1}' | openssl dgst -sha256 -hmac secret
+	const want = "sha256=03def589620c813f198fd03d7967e292b163ef0435ebf43071ce0e9519763cb7"
+	if got := SignWebhook("secret", []byte(`{"id":1}`)); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if SignWebhook("secret", []byte("a")) == SignWebhook("other", []byte("a")) {
+		t.Error("signatures of different secrets should differ")
+	}
+}
+
+func TestWebhooks_RetryDelay(t *testing.T) {
+	w := &Webhooks{Backoff: time.Second * 10, MaxBackoff: time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second * 10},
+		{1, time.Second * 20},
+		{2, time.Second * 40},
+		{3, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := w.retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDepositsIndexed(t *testing.T) {
+	deposits := []*repository.Deposit{
+		{Txid: "0xabc", LogIndex: sql.NullInt64{Int64: 0, Valid: true}},
+		{Txid: "0xabc", LogIndex: sql.NullInt64{Int64: 3, Valid: true}},
+	}
+	events := depositsIndexed(deposits)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].DedupKey != "0xabc:0" || events[1].DedupKey != "0xabc:3" || events[1].Event != EventDepositIndexed {
+		t.Errorf("unexpected events %+v %+v", events[0], events[1])
+	}
+}
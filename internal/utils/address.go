@@ -17,10 +17,6 @@ const (
 	MetisUSDCAddress = "0xea32a96608495e54156ae48931a7c20f0dcc1a21"
 )
 
-func IsStableL2Token(u string) bool {
-	return strings.EqualFold(u, MetisUSDCAddress) || strings.EqualFold(u, MetisUSDTAddress)
-}
-
 func ReadPrvkey(keyPath string) (*ecdsa.PrivateKey, common.Address, error) {
 	data, err := ioutil.ReadFile(keyPath)
 	if err != nil {
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Network is the profile of a metis chain
+type Network struct {
+	Name    string
+	ChainId uint64
+
+	BridgeAddress  string
+	MetisL2Address string
+	// StableL2Tokens are valued at 1 usd without a price lookup
+	StableL2Tokens []string
+	// PriceSubgraph is the uniswap v2 subgraph which prices the L1 tokens
+	PriceSubgraph string
+}
+
+var Networks = map[uint64]*Network{
+	AndromedaChainId: {
+		Name:           "andromeda",
+		ChainId:        AndromedaChainId,
+		BridgeAddress:  BridgeAddress,
+		MetisL2Address: MetisL2Address,
+		StableL2Tokens: []string{MetisUSDTAddress, MetisUSDCAddress},
+		PriceSubgraph:  UniswapV2Subgraph,
+	},
+	// the L1 of stardust is a testnet, the mainnet subgraph can't price its tokens,
+	// so the price source and the stable tokens are set by the chain config
+	StardustChainId: {
+		Name:           "stardust",
+		ChainId:        StardustChainId,
+		BridgeAddress:  BridgeAddress,
+		MetisL2Address: MetisL2Address,
+	},
+}
+
+func GetNetwork(chainId uint64) (*Network, error) {
+	network, ok := Networks[chainId]
+	if !ok {
+		return nil, fmt.Errorf("wrong network: %d", chainId)
+	}
+	return network, nil
+}
+
+// Override returns a copy of the profile with the fields which are set in o, the addresses are lowercase
+func (n *Network) Override(o Network) *Network {
+	var network = *n
+	if o.BridgeAddress != "" {
+		network.BridgeAddress = strings.ToLower(o.BridgeAddress)
+	}
+	if o.MetisL2Address != "" {
+		network.MetisL2Address = strings.ToLower(o.MetisL2Address)
+	}
+	if len(o.StableL2Tokens) > 0 {
+		network.StableL2Tokens = nil
+		for _, item := range o.StableL2Tokens {
+			network.StableL2Tokens = append(network.StableL2Tokens, strings.ToLower(item))
+		}
+	}
+	if o.PriceSubgraph != "" {
+		network.PriceSubgraph = o.PriceSubgraph
+	}
+	return &network
+}
+
+// Validate reports the fields the profile misses, the price source is only needed if pricing is set
+func (n *Network) Validate(pricing bool) error {
+	if !common.IsHexAddress(n.BridgeAddress) {
+		return fmt.Errorf("%s: invalid bridge address %q", n.Name, n.BridgeAddress)
+	}
+	if !common.IsHexAddress(n.MetisL2Address) {
+		return fmt.Errorf("%s: invalid metis token address %q", n.Name, n.MetisL2Address)
+	}
+	for _, item := range n.StableL2Tokens {
+		if !common.IsHexAddress(item) {
+			return fmt.Errorf("%s: invalid stable token address %q", n.Name, item)
+		}
+	}
+	if pricing && n.PriceSubgraph == "" {
+		return fmt.Errorf("%s: no price subgraph", n.Name)
+	}
+	return nil
+}
+
+func (n *Network) IsStableL2Token(u string) bool {
+	for _, item := range n.StableL2Tokens {
+		if strings.EqualFold(u, item) {
+			return true
+		}
+	}
+	return false
+}
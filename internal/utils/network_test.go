@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetwork_Override(t *testing.T) {
+	stardust, err := GetNetwork(StardustChainId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := stardust.Override(Network{
+		StableL2Tokens: []string{"0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},
+		PriceSubgraph:  "https://subgraph.example",
+	})
+	if network == stardust || stardust.PriceSubgraph != "" {
+		t.Fatal("Override() should not change the built-in profile")
+	}
+	if network.BridgeAddress != BridgeAddress || network.MetisL2Address != MetisL2Address {
+		t.Errorf("the fields which are not set should be kept, got %+v", network)
+	}
+	if !reflect.DeepEqual(network.StableL2Tokens, []string{"0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}) || network.PriceSubgraph != "https://subgraph.example" {
+		t.Errorf("the fields which are set should override the profile, got %+v", network)
+	}
+	if !network.IsStableL2Token("0xAaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa") {
+		t.Error("the stable tokens should be matched case insensitively")
+	}
+}
+
+func TestNetwork_Validate(t *testing.T) {
+	andromeda, _ := GetNetwork(AndromedaChainId)
+	stardust, _ := GetNetwork(StardustChainId)
+	tests := []struct {
+		name    string
+		network *Network
+		pricing bool
+		wantErr bool
+	}{
+		{"andromeda", andromeda, true, false},
+		{"stardust without pricing", stardust, false, false},
+		{"stardust without a price source", stardust, true, true},
+		{"stardust with a price source", stardust.Override(Network{PriceSubgraph: "https://subgraph.example"}), true, false},
+		{"invalid bridge", andromeda.Override(Network{BridgeAddress: "0x42"}), false, true},
+		{"invalid stable token", andromeda.Override(Network{StableL2Tokens: []string{"usdt"}}), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.network.Validate(tt.pricing); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
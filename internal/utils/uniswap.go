@@ -14,9 +14,14 @@ type Uniswap struct {
 	client *graphql.Client
 }
 
+const UniswapV2Subgraph = "https://api.thegraph.com/subgraphs/name/uniswap/uniswap-v2"
+
 func NewUniswap() *Uniswap {
-	const uniswapv2_subgraph_api = "https://api.thegraph.com/subgraphs/name/uniswap/uniswap-v2"
-	return &Uniswap{graphql.New(uniswapv2_subgraph_api)}
+	return NewUniswapWithEndpoint(UniswapV2Subgraph)
+}
+
+func NewUniswapWithEndpoint(endpoint string) *Uniswap {
+	return &Uniswap{graphql.New(endpoint)}
 }
 
 type Uniswaper interface {
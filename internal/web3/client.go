@@ -0,0 +1,192 @@
+package web3
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func (p *Pool) ChainID(ctx context.Context) (*big.Int, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.ChainID(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*big.Int), nil
+}
+
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.BlockNumber(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint64), nil
+}
+
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*types.Header), nil
+}
+
+func (p *Pool) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.BalanceAt(ctx, account, blockNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*big.Int), nil
+}
+
+func (p *Pool) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.CodeAt(ctx, account, blockNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]byte), nil
+}
+
+func (p *Pool) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.NonceAt(ctx, account, blockNumber)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint64), nil
+}
+
+func (p *Pool) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.PendingCodeAt(ctx, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]byte), nil
+}
+
+// PendingNonceAt asks the send endpoints which know the pending transactions
+func (p *Pool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	res, err := p.send(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.PendingNonceAt(ctx, account)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint64), nil
+}
+
+func (p *Pool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.CallContract(ctx, msg, blockNumber)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]byte), nil
+}
+
+func (p *Pool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.SuggestGasPrice(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*big.Int), nil
+}
+
+func (p *Pool) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.SuggestGasTipCap(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*big.Int), nil
+}
+
+func (p *Pool) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.EstimateGas(ctx, msg)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.(uint64), nil
+}
+
+func (p *Pool) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.TransactionReceipt(ctx, txHash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*types.Receipt), nil
+}
+
+func (p *Pool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	res, err := p.read(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.FilterLogs(ctx, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]types.Log), nil
+}
+
+// SendTransaction uses the send endpoints if there are any
+func (p *Pool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	_, err := p.send(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return nil, c.SendTransaction(ctx, tx)
+	})
+	return err
+}
+
+// BatchCallContext sends the calls in one json-rpc batch, the error of each call is set in its element.
+// It's not hedged, the elements would be written by two endpoints at once.
+func (p *Pool) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	_, err := p.call(ctx, p.reads, false, func(ctx context.Context, c *conn) (interface{}, error) {
+		return nil, c.raw.BatchCallContext(ctx, b)
+	})
+	return err
+}
+
+// subscriptions are not hedged, they live on the endpoint which accepts them.
+// Only the websocket and ipc endpoints are tried, http ones can't push notifications.
+
+func (p *Pool) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	res, err := p.subscribe(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.SubscribeFilterLogs(ctx, q, ch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(ethereum.Subscription), nil
+}
+
+func (p *Pool) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	res, err := p.subscribe(ctx, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.SubscribeNewHead(ctx, ch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(ethereum.Subscription), nil
+}
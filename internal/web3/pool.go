@@ -0,0 +1,364 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNoEndpoint = errors.New("web3: no rpc endpoint available")
+
+// conn is the connection to an endpoint, the raw client is kept for batch calls
+type conn struct {
+	*ethclient.Client
+	raw *rpc.Client
+}
+
+func newConn(raw *rpc.Client) *conn {
+	return &conn{Client: ethclient.NewClient(raw), raw: raw}
+}
+
+func dial(ctx context.Context, url string) (*conn, error) {
+	raw, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(raw), nil
+}
+
+type endpoint struct {
+	url    string
+	client *conn
+
+	healthy bool
+	head    uint64
+	err     error
+}
+
+// Pool spreads calls over several rpc endpoints of the same chain.
+// Endpoints are probed periodically, calls go to healthy endpoints in the configured order
+// and fail over to the next one on endpoint errors.
+type Pool struct {
+	// Hedge starts the same read call on the next endpoint if there is no result after it, 0 means disabled
+	Hedge time.Duration
+	// MaxLag is how many blocks an endpoint can fall behind the best head of the pool
+	MaxLag uint64
+	// MaxStale is how old the head of an endpoint can be by the wall clock, 0 means unchecked.
+	// It catches the endpoints stalled together, which don't lag behind each other.
+	MaxStale time.Duration
+
+	chainId *big.Int
+	reads   []*endpoint
+	sends   []*endpoint
+	mu      sync.RWMutex
+}
+
+// Dial connects to the endpoints, sends fall back to reads if empty.
+// The chain id of the pool is taken from the first endpoint which answers,
+// endpoints of other chains are never used.
+func Dial(ctx context.Context, reads, sends []string) (*Pool, error) {
+	if len(reads) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	p := &Pool{MaxLag: 10}
+	for _, url := range reads {
+		p.reads = append(p.reads, &endpoint{url: url})
+	}
+	for _, url := range sends {
+		p.sends = append(p.sends, &endpoint{url: url})
+	}
+
+	for _, item := range p.endpoints() {
+		client, err := dial(ctx, item.url)
+		if err != nil {
+			item.err = err
+			continue
+		}
+		item.client = client
+		if p.chainId == nil {
+			if p.chainId, err = client.ChainID(ctx); err != nil {
+				item.err, p.chainId = err, nil
+			}
+		}
+	}
+	if p.chainId == nil {
+		return nil, fmt.Errorf("web3: unable to get chain id from any endpoint")
+	}
+
+	p.Probe(ctx)
+	return p, nil
+}
+
+func (p *Pool) endpoints() []*endpoint {
+	return append(append([]*endpoint{}, p.reads...), p.sends...)
+}
+
+// ExpectedChainID returns the chain id which every endpoint should serve
+func (p *Pool) ExpectedChainID() *big.Int {
+	return new(big.Int).Set(p.chainId)
+}
+
+// Run probes the endpoints at the interval until the context is done
+func (p *Pool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Probe(ctx)
+		}
+	}
+}
+
+// Probe checks the chain id and the head of every endpoint
+func (p *Pool) Probe(basectx context.Context) {
+	var wg sync.WaitGroup
+	var heads = make([]uint64, len(p.endpoints()))
+	var errs = make([]error, len(heads))
+	for i, item := range p.endpoints() {
+		wg.Add(1)
+		go func(i int, item *endpoint) {
+			defer wg.Done()
+			newctx, cancel := context.WithTimeout(basectx, time.Second*5)
+			defer cancel()
+			heads[i], errs[i] = p.probe(newctx, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	if basectx.Err() != nil {
+		return
+	}
+
+	var best uint64
+	for i := range heads {
+		if errs[i] == nil && heads[i] > best {
+			best = heads[i]
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, item := range p.endpoints() {
+		err := errs[i]
+		if err == nil && best-heads[i] > p.MaxLag {
+			err = fmt.Errorf("head %d is %d blocks behind", heads[i], best-heads[i])
+		}
+		p.setState(item, heads[i], err)
+	}
+}
+
+func (p *Pool) probe(ctx context.Context, item *endpoint) (uint64, error) {
+	p.mu.RLock()
+	client := item.client
+	p.mu.RUnlock()
+
+	if client == nil {
+		var err error
+		if client, err = dial(ctx, item.url); err != nil {
+			return 0, err
+		}
+		p.mu.Lock()
+		item.client = client
+		p.mu.Unlock()
+	}
+
+	chainId, err := client.ChainID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if chainId.Cmp(p.chainId) != 0 {
+		return 0, fmt.Errorf("chain id %s does not match %s", chainId, p.chainId)
+	}
+	if p.MaxStale <= 0 {
+		return client.BlockNumber(ctx)
+	}
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	head := header.Number.Uint64()
+	if age := time.Since(time.Unix(int64(header.Time), 0)); age > p.MaxStale {
+		return head, fmt.Errorf("head %d is %s old", head, age.Truncate(time.Second))
+	}
+	return head, nil
+}
+
+// setState should be called with the lock held
+func (p *Pool) setState(item *endpoint, head uint64, err error) {
+	if healthy := err == nil; healthy != item.healthy {
+		if healthy {
+			logrus.Infof("rpc endpoint %s is up at %d", item.url, head)
+		} else {
+			logrus.Warnf("rpc endpoint %s is down: %s", item.url, err)
+		}
+	}
+	item.healthy, item.err = err == nil, err
+	if err == nil {
+		item.head = head
+	}
+}
+
+// candidates returns the healthy endpoints followed by the unhealthy ones as a last resort
+func (p *Pool) candidates(list []*endpoint) []*endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var healthy, unhealthy []*endpoint
+	for _, item := range list {
+		if item.client == nil {
+			continue
+		}
+		if item.healthy {
+			healthy = append(healthy, item)
+		} else {
+			unhealthy = append(unhealthy, item)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// Healthy reports how many read endpoints are healthy
+func (p *Pool) Healthy() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var count int
+	for _, item := range p.reads {
+		if item.healthy {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, item := range p.endpoints() {
+		if item.client != nil {
+			item.client.Close()
+		}
+	}
+}
+
+// isEndpointError reports whether the error is caused by the endpoint rather than by the request,
+// a json-rpc error response, a missing result or an unsupported subscription is an answer of a working endpoint
+func isEndpointError(err error) bool {
+	if errors.Is(err, ethereum.NotFound) || errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+type callFunc func(ctx context.Context, client *conn) (interface{}, error)
+
+type callResult struct {
+	value interface{}
+	err   error
+	from  *endpoint
+}
+
+// call runs fn on the candidates one by one until one of them answers,
+// the next candidate is also started if hedging is enabled and there is no answer in time
+func (p *Pool) call(basectx context.Context, list []*endpoint, hedge bool, fn callFunc) (interface{}, error) {
+	candidates := p.candidates(list)
+	if len(candidates) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	ctx, cancel := context.WithCancel(basectx)
+	defer cancel()
+
+	var results = make(chan callResult, len(candidates))
+	var launched, pending int
+	launch := func() {
+		item := candidates[launched]
+		launched++
+		pending++
+		go func() {
+			value, err := fn(ctx, item.client)
+			results <- callResult{value: value, err: err, from: item}
+		}()
+	}
+
+	var hedgeC <-chan time.Time
+	if hedge && p.Hedge > 0 {
+		timer := time.NewTimer(p.Hedge)
+		defer timer.Stop()
+		hedgeC = timer.C
+	}
+
+	var lastErr error
+	launch()
+	for pending > 0 {
+		select {
+		case <-hedgeC:
+			if launched < len(candidates) {
+				launch()
+				hedgeC = time.After(p.Hedge)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil || !isEndpointError(res.err) || basectx.Err() != nil {
+				return res.value, res.err
+			}
+			p.markDown(res.from, res.err)
+			lastErr = res.err
+			if launched < len(candidates) {
+				launch()
+			}
+		}
+	}
+	return nil, fmt.Errorf("web3: all %d endpoints failed, last error: %w", len(candidates), lastErr)
+}
+
+func (p *Pool) markDown(item *endpoint, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setState(item, item.head, err)
+}
+
+func (p *Pool) read(ctx context.Context, fn callFunc) (interface{}, error) {
+	return p.call(ctx, p.reads, true, fn)
+}
+
+func (p *Pool) send(ctx context.Context, fn callFunc) (interface{}, error) {
+	if len(p.sends) > 0 {
+		return p.call(ctx, p.sends, false, fn)
+	}
+	return p.call(ctx, p.reads, false, fn)
+}
+
+// subscribe runs fn on the read endpoints which support notifications, i.e. websocket and ipc ones
+func (p *Pool) subscribe(ctx context.Context, fn callFunc) (interface{}, error) {
+	var list []*endpoint
+	for _, item := range p.reads {
+		if !isHTTP(item.url) {
+			list = append(list, item)
+		}
+	}
+	if len(list) == 0 {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	return p.call(ctx, list, false, fn)
+}
+
+func isHTTP(url string) bool {
+	url = strings.ToLower(url)
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
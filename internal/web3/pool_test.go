@@ -0,0 +1,224 @@
+package web3
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type fakeEth struct {
+	chainId uint64
+	head    uint64
+	delay   time.Duration
+	// headTime is the timestamp of the head block
+	headTime time.Time
+}
+
+func (f *fakeEth) ChainId() hexutil.Uint64 {
+	return hexutil.Uint64(f.chainId)
+}
+
+func (f *fakeEth) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(f.delay):
+	}
+	return hexutil.Uint64(f.head), nil
+}
+
+func (f *fakeEth) GetBlockByNumber(number string, full bool) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(f.head), Difficulty: big.NewInt(0), Time: uint64(f.headTime.Unix())}
+}
+
+// NewHeads pushes the head once to the subscriber
+func (f *fakeEth) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go notifier.Notify(sub.ID, &types.Header{Number: new(big.Int).SetUint64(f.head), Difficulty: big.NewInt(0)})
+	return sub, nil
+}
+
+func newTestPool(t *testing.T, fakes ...*fakeEth) *Pool {
+	p := &Pool{MaxLag: 10, chainId: big.NewInt(1088)}
+	for i, item := range fakes {
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", item); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(server.Stop)
+		p.reads = append(p.reads, &endpoint{url: string(rune('a' + i)), client: newConn(rpc.DialInProc(server))})
+	}
+	p.Probe(context.Background())
+	return p
+}
+
+func TestPool_Probe(t *testing.T) {
+	p := newTestPool(t,
+		&fakeEth{chainId: 588, head: 100},
+		&fakeEth{chainId: 1088, head: 50},
+		&fakeEth{chainId: 1088, head: 100},
+	)
+
+	if got := p.Healthy(); got != 1 {
+		t.Errorf("Pool.Healthy() = %d, want 1", got)
+	}
+	if candidates := p.candidates(p.reads); candidates[0] != p.reads[2] {
+		t.Errorf("the healthy endpoint should be the first candidate, got %s", candidates[0].url)
+	}
+}
+
+func TestPool_ProbeStale(t *testing.T) {
+	p := newTestPool(t,
+		&fakeEth{chainId: 1088, head: 100, headTime: time.Now().Add(-time.Hour)},
+		&fakeEth{chainId: 1088, head: 100, headTime: time.Now().Add(-time.Hour)},
+		&fakeEth{chainId: 1088, head: 100, headTime: time.Now()},
+	)
+	if got := p.Healthy(); got != 3 {
+		t.Fatalf("Pool.Healthy() = %d without the stale check, want 3", got)
+	}
+
+	// the stalled endpoints are on the same head as the fresh one, so none of them lags behind
+	p.MaxStale = time.Minute * 10
+	p.Probe(context.Background())
+	if got := p.Healthy(); got != 1 || !p.reads[2].healthy {
+		t.Errorf("Pool.Healthy() = %d, want only the fresh endpoint healthy", got)
+	}
+}
+
+func TestPool_Failover(t *testing.T) {
+	p := newTestPool(t, &fakeEth{chainId: 1088, head: 100}, &fakeEth{chainId: 1088, head: 101})
+	p.reads[0].client.Close()
+
+	head, err := p.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != 101 {
+		t.Errorf("Pool.BlockNumber() = %d, want 101 from the second endpoint", head)
+	}
+	if p.reads[0].healthy {
+		t.Errorf("the closed endpoint should be marked down")
+	}
+}
+
+func TestPool_Hedge(t *testing.T) {
+	slow := &fakeEth{chainId: 1088, head: 100}
+	p := newTestPool(t, slow, &fakeEth{chainId: 1088, head: 101})
+	slow.delay = time.Second * 5
+	p.Hedge = time.Millisecond * 50
+
+	begin := time.Now()
+	head, err := p.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != 101 || time.Since(begin) > time.Second {
+		t.Errorf("Pool.BlockNumber() = %d in %s, want 101 from the hedged endpoint", head, time.Since(begin))
+	}
+}
+
+func TestIsEndpointError(t *testing.T) {
+	p := newTestPool(t, &fakeEth{chainId: 1088, head: 100})
+	_, err := p.TransactionReceipt(context.Background(), [32]byte{})
+	if err == nil || isEndpointError(err) {
+		t.Errorf("an unknown method is answered by the endpoint, got %v", err)
+	}
+	if !p.reads[0].healthy {
+		t.Errorf("the endpoint should stay healthy")
+	}
+}
+
+func TestPool_BatchCallContext(t *testing.T) {
+	p := newTestPool(t, &fakeEth{chainId: 1088, head: 100})
+
+	var chainId, head hexutil.Uint64
+	batch := []rpc.BatchElem{
+		{Method: "eth_chainId", Result: &chainId},
+		{Method: "eth_blockNumber", Result: &head},
+		{Method: "eth_unknown", Result: new(hexutil.Uint64)},
+	}
+	if err := p.BatchCallContext(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil || batch[1].Error != nil || chainId != 1088 || head != 100 {
+		t.Errorf("unexpected results chainId=%d head=%d errors=%v %v", chainId, head, batch[0].Error, batch[1].Error)
+	}
+	if batch[2].Error == nil {
+		t.Errorf("the unknown method should fail in its element")
+	}
+}
+
+// newHTTPEndpoint serves the fake over http, which can't push notifications
+func newHTTPEndpoint(t *testing.T, fake *fakeEth) *endpoint {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", fake); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	t.Cleanup(server.Stop)
+	client, err := rpc.DialHTTP(httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &endpoint{url: httpServer.URL, client: newConn(client)}
+}
+
+func TestPool_SubscribeNewHead(t *testing.T) {
+	p := newTestPool(t, &fakeEth{chainId: 1088, head: 100})
+	p.reads[0].url = "ws://b"
+	p.reads = append([]*endpoint{newHTTPEndpoint(t, &fakeEth{chainId: 1088, head: 101})}, p.reads...)
+	p.Probe(context.Background())
+
+	heads := make(chan *types.Header, 1)
+	sub, err := p.SubscribeNewHead(context.Background(), heads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case head := <-heads:
+		if head.Number.Uint64() != 100 {
+			t.Errorf("got head %d, want 100 from the websocket endpoint", head.Number)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no head from the subscription")
+	}
+	if got := p.Healthy(); got != 2 {
+		t.Errorf("Pool.Healthy() = %d, want 2", got)
+	}
+}
+
+func TestPool_SubscribeHTTPOnly(t *testing.T) {
+	p := &Pool{MaxLag: 10, chainId: big.NewInt(1088)}
+	p.reads = append(p.reads, newHTTPEndpoint(t, &fakeEth{chainId: 1088, head: 100}))
+	p.Probe(context.Background())
+
+	_, err := p.SubscribeNewHead(context.Background(), make(chan *types.Header))
+	if !errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		t.Errorf("Pool.SubscribeNewHead() = %v, want %v", err, rpc.ErrNotificationsUnsupported)
+	}
+
+	// a subscription on an http endpoint is refused by the client, the endpoint is still up
+	_, err = p.call(context.Background(), p.reads, false, func(ctx context.Context, c *conn) (interface{}, error) {
+		return c.SubscribeNewHead(ctx, make(chan *types.Header))
+	})
+	if !errors.Is(err, rpc.ErrNotificationsUnsupported) || isEndpointError(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !p.reads[0].healthy {
+		t.Errorf("the http endpoint should stay healthy")
+	}
+}
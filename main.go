@@ -9,73 +9,85 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/api"
 	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
 	"github.com/ericlee42/metis-bridge-faucet/internal/services"
-	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				logrus.Fatal(err)
+			}
+			return
+		}
+	}
+
 	var (
-		MinUSD        float64
-		DripAmount    float64
-		Web3Endpoint  string
 		MysqlEndpoint string
-		RangeSync     uint64
-		DripHeight    uint64
-		KeyPath       string
-		OpenFaucet    bool
+		ApiEndpoint   string
+		ChainsPath    string
+		OutboxSink    string
+		Shutdown      time.Duration
+		Instance      string
+		LeaseTTL      time.Duration
+		Defaults      chainConfig
 	)
 
-	flag.Float64Var(&MinUSD, "minusd", 500, "min usd value")
-	flag.Float64Var(&DripAmount, "drip", 0.01, "metis amount to transfer")
-	flag.StringVar(&Web3Endpoint, "rpc", "wss://andromeda-ws.metis.io", "rpc endpoint")
-	flag.StringVar(&MysqlEndpoint, "mysql", "root:Pa$$w0rd@tcp(127.0.0.1:3306)/metis?parseTime=true", "mysql endpoint")
-	flag.Uint64Var(&RangeSync, "range", 20, "range sync at once")
-	flag.Uint64Var(&DripHeight, "height", 100, "height to transfer a drip")
-	flag.StringVar(&KeyPath, "key", "key.txt", "private key path")
-	flag.BoolVar(&OpenFaucet, "faucet", false, "faucet")
+	flag.StringVar(&MysqlEndpoint, "mysql", defaultMysqlEndpoint, "mysql endpoint")
+	flag.StringVar(&ApiEndpoint, "api", "", "http api listen address, empty means disabled")
+	flag.StringVar(&ChainsPath, "chains", "", "json file of chain configs to run several chains, the other flags are their defaults")
+	flag.StringVar(&OutboxSink, "outbox", "", "sink to publish the outbox events, stdout, file:<path> or nats://[user:pass@]host:port/subject, empty means disabled")
+	flag.DurationVar(&Shutdown, "shutdown-timeout", time.Second*30, "time to broadcast the committed drips when shutting down")
+	flag.StringVar(&Instance, "instance", defaultInstance(), "replica id used for leader election")
+	flag.DurationVar(&LeaseTTL, "lease-ttl", 0, "lease ttl of the sync, faucet and outbox roles for leader election, 0 means disabled")
+	Defaults.registerFlags(flag.CommandLine)
 	flag.Parse()
 
-	if RangeSync < 20 {
-		RangeSync = 20
-	}
-	if DripAmount <= 0 {
-		DripAmount = 0.01
-	}
-
-	// connect to rpc
-	rpc, err := ethclient.Dial(Web3Endpoint)
-	if err != nil {
-		logrus.Fatalf("unable to connect to rpc: %s", err)
+	var configs = []chainConfig{Defaults}
+	if ChainsPath != "" {
+		var err error
+		if configs, err = loadChainConfigs(ChainsPath, Defaults); err != nil {
+			logrus.Fatal(err)
+		}
 	}
-	defer rpc.Close()
 
-	chainId, err := rpc.ChainID(context.Background())
+	// connect to mysql
+	mysql, err := repository.Connect(MysqlEndpoint)
 	if err != nil {
-		logrus.Fatalf("unable to get chain id: %s", err)
+		logrus.Fatalf("unable to connect to mysql: %s", err)
 	}
+	defer mysql.Close()
 
-	if id := chainId.Uint64(); id != utils.AndromedaChainId && id != utils.StardustChainId {
-		logrus.Fatalf("wrong network: %d", id)
+	var opts = pipelineOptions{instance: Instance, leaseTTL: LeaseTTL, backfill: len(configs) == 1}
+	if OutboxSink != "" {
+		if opts.sink, err = services.NewSink(OutboxSink); err != nil {
+			logrus.Fatalf("unable to create outbox sink: %s", err)
+		}
+		defer opts.sink.Close()
 	}
 
-	bridge, err := metisl2.NewL2StandardBridge(common.HexToAddress(utils.BridgeAddress), rpc)
-	if err != nil {
-		logrus.Fatalf("unable to create bridge instance: %s", err)
-	}
+	var pipelines []*pipeline
+	var chains = make(map[uint64]*api.Chain)
+	for _, config := range configs {
+		if err := config.normalize(); err != nil {
+			logrus.Fatal(err)
+		}
+		p, err := newPipeline(context.Background(), config, mysql, opts)
+		if err != nil {
+			logrus.Fatalf("chain %d: %s", config.ChainId, err)
+		}
+		defer p.close()
 
-	// connect to mysql
-	mysql, err := repository.Connect(MysqlEndpoint)
-	if err != nil {
-		logrus.Fatalf("unable to connect to mysql: %s", err)
+		if _, ok := chains[p.network.ChainId]; ok {
+			logrus.Fatalf("chain %d is configured twice", p.network.ChainId)
+		}
+		chains[p.network.ChainId] = p.api()
+		pipelines = append(pipelines, p)
 	}
-	defer mysql.Close()
 
 	basectx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -89,74 +101,35 @@ func main() {
 	eg, egctx := errgroup.WithContext(basectx)
 
 	eg.Go(func() error {
-		syncer := &services.DataSync{
-			Web3Client: rpc,
-			Repositroy: repository.NewMetis(mysql),
-			Bridge:     bridge,
-			RangeSync:  RangeSync,
-			DripHeight: DripHeight,
-		}
-		if err := syncer.Prefight(egctx); err != nil {
-			return err
-		}
-		logrus.Info("fetching new events")
-		timer := time.NewTimer(0)
-		for {
-			select {
-			case <-egctx.Done():
-				return nil
-			case <-timer.C:
-				syncer.Run(basectx)
-				timer.Reset(time.Minute / 2)
-			}
+		if ApiEndpoint == "" {
+			return nil
 		}
+		server := &api.Server{Chains: chains}
+		return server.ListenAndServe(egctx, ApiEndpoint)
 	})
 
-	eg.Go(func() error {
-		if !OpenFaucet {
-			return nil
-		}
+	for _, p := range pipelines {
+		p.run(eg, egctx)
+	}
 
-		prvkey, wallet, err := utils.ReadPrvkey(KeyPath)
-		if err != nil {
-			return fmt.Errorf("unable to read pricate key: %s", err)
-		}
-		logrus.Infof("Current wallet address is %s", wallet)
-
-		faucet := &services.Faucet{
-			Web3Client:   rpc,
-			Repositroy:   repository.NewMetis(mysql),
-			Uniswap:      utils.NewUniswap(),
-			Prvkey:       prvkey,
-			Account:      wallet,
-			Eip155Signer: types.NewEIP155Signer(chainId),
-			DripHeight:   DripHeight,
-			DripAmount:   utils.ToWei(DripAmount),
-			MinUSD:       MinUSD,
-		}
-		if err := faucet.Initial(egctx); err != nil {
-			return err
-		}
+	// the loops return once the shutdown begins, then the committed drips are drained
+	err = eg.Wait()
+	logrus.Info("Shutting down")
 
-		timer := time.NewTimer(0)
-		for {
-			select {
-			case <-egctx.Done():
-				return nil
-			case <-timer.C:
-				faucet.SendDrips(egctx)
-				select {
-				case <-egctx.Done():
-					return nil
-				case <-time.After(time.Second * 5):
-					faucet.CheckDrips(egctx)
-				}
-				timer.Reset(time.Minute)
-			}
+	drainctx, cancelDrain := context.WithTimeout(context.Background(), Shutdown)
+	defer cancelDrain()
+	for _, p := range pipelines {
+		if err := p.drain(drainctx); err != nil {
+			logrus.Errorf("chain %d: %s", p.network.ChainId, err)
 		}
-	})
+	}
 
-	if err := eg.Wait(); err != nil {
+	if err != nil {
 		logrus.Fatal(err)
 	}
 }
+
+func defaultInstance() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
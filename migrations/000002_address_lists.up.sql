@@ -0,0 +1,10 @@
+CREATE TABLE `address_lists` (
+    `address` char(42) NOT NULL,
+    `kind` tinyint NOT NULL,
+    `reason` varchar(255) NOT NULL DEFAULT '',
+    `expiry` datetime NULL,
+    `ctime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `mtime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT pk_address PRIMARY KEY (`address`),
+    INDEX idx_kind (`kind`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
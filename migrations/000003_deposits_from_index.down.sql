@@ -0,0 +1 @@
+ALTER TABLE `deposits` DROP INDEX idx_from;
@@ -0,0 +1 @@
+ALTER TABLE `deposits` ADD INDEX idx_from (`from`);
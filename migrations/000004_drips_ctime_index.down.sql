@@ -0,0 +1 @@
+ALTER TABLE `drips` DROP INDEX idx_ctime;
@@ -0,0 +1 @@
+ALTER TABLE `drips` ADD INDEX idx_ctime (`ctime`);
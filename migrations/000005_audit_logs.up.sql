@@ -0,0 +1,10 @@
+CREATE TABLE `audit_logs` (
+    `id` bigint UNSIGNED AUTO_INCREMENT,
+    `operator` varchar(64) NOT NULL,
+    `action` varchar(64) NOT NULL,
+    `target` varchar(128) NOT NULL,
+    `detail` varchar(255) NOT NULL DEFAULT '',
+    `ctime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pk_id PRIMARY KEY (`id`),
+    INDEX idx_target (`target`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
@@ -0,0 +1,3 @@
+ALTER TABLE `deposits`
+    DROP INDEX uk_txid_log_index,
+    DROP COLUMN `log_index`;
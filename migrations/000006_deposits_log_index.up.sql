@@ -0,0 +1,3 @@
+ALTER TABLE `deposits`
+    ADD COLUMN `log_index` int UNSIGNED NULL AFTER `txid`,
+    ADD UNIQUE INDEX uk_txid_log_index (`txid`, `log_index`);
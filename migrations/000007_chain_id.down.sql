@@ -0,0 +1,13 @@
+ALTER TABLE `drips`
+    DROP INDEX idx_chain_id_to,
+    DROP COLUMN `chain_id`;
+
+ALTER TABLE `deposits`
+    DROP INDEX idx_chain_id_status,
+    DROP INDEX uk_chain_id_txid_log_index,
+    ADD UNIQUE INDEX uk_txid_log_index (`txid`, `log_index`),
+    DROP COLUMN `chain_id`;
+
+ALTER TABLE `height`
+    DROP INDEX uk_chain_id,
+    DROP COLUMN `chain_id`;
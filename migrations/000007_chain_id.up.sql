@@ -0,0 +1,15 @@
+-- rows synced before multiple chains were supported have no chain id,
+-- the faucet assigns them to its chain when it starts with a single chain, see Metis.BackfillChainId
+ALTER TABLE `height`
+    ADD COLUMN `chain_id` bigint UNSIGNED NULL FIRST,
+    ADD UNIQUE INDEX uk_chain_id (`chain_id`);
+
+ALTER TABLE `deposits`
+    ADD COLUMN `chain_id` bigint UNSIGNED NULL AFTER `id`,
+    DROP INDEX uk_txid_log_index,
+    ADD UNIQUE INDEX uk_chain_id_txid_log_index (`chain_id`, `txid`, `log_index`),
+    ADD INDEX idx_chain_id_status (`chain_id`, `status`);
+
+ALTER TABLE `drips`
+    ADD COLUMN `chain_id` bigint UNSIGNED NULL AFTER `pid`,
+    ADD INDEX idx_chain_id_to (`chain_id`, `to`);
@@ -0,0 +1,10 @@
+CREATE TABLE `tokens` (
+    `chain_id` bigint UNSIGNED NOT NULL,
+    `address` char(42) NOT NULL,
+    `l1token` char(42) NOT NULL,
+    `name` varchar(128) NOT NULL DEFAULT '',
+    `symbol` varchar(32) NOT NULL DEFAULT '',
+    `decimals` tinyint UNSIGNED NOT NULL,
+    `ctime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT pk_chain_id_address PRIMARY KEY (`chain_id`, `address`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
@@ -0,0 +1,3 @@
+-- the cached tokens are fetched again to be verified
+TRUNCATE TABLE `tokens`;
+ALTER TABLE `tokens` ADD COLUMN `standard` tinyint(1) NOT NULL DEFAULT 0 AFTER `decimals`;
@@ -0,0 +1,20 @@
+-- the events written with the changes, the webhooks deliver them and the sink publishes them.
+-- status is the delivery state of the webhook, published_at is set once the sink has published the event.
+CREATE TABLE `outbox` (
+    `id` bigint UNSIGNED AUTO_INCREMENT,
+    `chain_id` bigint UNSIGNED NOT NULL,
+    `event` varchar(32) NOT NULL,
+    `dedup_key` varchar(128) NOT NULL,
+    `payload` text NOT NULL,
+    `status` tinyint NOT NULL DEFAULT 0,
+    `attempts` int UNSIGNED NOT NULL DEFAULT 0,
+    `next_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `last_error` varchar(255) NOT NULL DEFAULT '',
+    `published_at` datetime NULL,
+    `ctime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `mtime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT pk_id PRIMARY KEY (`id`),
+    UNIQUE KEY uk_chain_id_event_dedup_key (`chain_id`, `event`, `dedup_key`),
+    INDEX idx_chain_id_status_next_at (`chain_id`, `status`, `next_at`),
+    INDEX idx_chain_id_published_at (`chain_id`, `published_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
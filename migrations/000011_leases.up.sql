@@ -0,0 +1,8 @@
+CREATE TABLE `leases` (
+    `name` varchar(64) NOT NULL,
+    `holder` varchar(128) NOT NULL DEFAULT '',
+    `token` bigint UNSIGNED NOT NULL DEFAULT 0,
+    `expiry` datetime(3) NOT NULL,
+    `mtime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT pk_name PRIMARY KEY (`name`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
@@ -0,0 +1,3 @@
+ALTER TABLE `deposits`
+    DROP COLUMN `claim_owner`,
+    DROP COLUMN `claim_expiry`;
@@ -0,0 +1,3 @@
+ALTER TABLE `deposits`
+    ADD COLUMN `claim_owner` varchar(128) NOT NULL DEFAULT '',
+    ADD COLUMN `claim_expiry` datetime(3) NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE `deposits`
+    DROP COLUMN `check_mode`;
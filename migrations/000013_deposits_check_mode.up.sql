@@ -0,0 +1,2 @@
+ALTER TABLE `deposits`
+    ADD COLUMN `check_mode` varchar(16) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE `shadow_drips`;
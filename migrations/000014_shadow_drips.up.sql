@@ -0,0 +1,15 @@
+CREATE TABLE `shadow_drips` (
+    `pid` bigint UNSIGNED NOT NULL,
+    `chain_id` bigint UNSIGNED NOT NULL,
+    `txid` varchar(66) NOT NULL DEFAULT '',
+    `from` varchar(42) NOT NULL DEFAULT '',
+    `to` char(42) NOT NULL,
+    `amount` decimal(64, 20) NOT NULL DEFAULT 0,
+    `rawtx` blob NULL,
+    `reason` varchar(255) NOT NULL DEFAULT '',
+    `check_mode` varchar(16) NOT NULL DEFAULT '',
+    `ctime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `mtime` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT pk_pid PRIMARY KEY (`pid`),
+    INDEX idx_chain_id_pid (`chain_id`, `pid`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_general_ci;
@@ -0,0 +1,2 @@
+-- non-standard verdicts are verified again once they are older than the recheck interval
+ALTER TABLE `tokens` ADD COLUMN `checked_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `standard`;
@@ -0,0 +1 @@
+ALTER TABLE `drips` DROP INDEX uk_chain_id_to;
@@ -0,0 +1,3 @@
+-- a receiver gets one drip per chain, the key keeps concurrent faucet workers from dripping to it twice.
+-- It fails if a receiver has several drips already, they have to be resolved first.
+ALTER TABLE `drips` ADD UNIQUE KEY uk_chain_id_to (`chain_id`, `to`);
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ericlee42/metis-bridge-faucet/internal/api"
+	"github.com/ericlee42/metis-bridge-faucet/internal/goabi/metisl2"
+	"github.com/ericlee42/metis-bridge-faucet/internal/repository"
+	"github.com/ericlee42/metis-bridge-faucet/internal/services"
+	"github.com/ericlee42/metis-bridge-faucet/internal/utils"
+	"github.com/ericlee42/metis-bridge-faucet/internal/web3"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// pipeline syncs the deposits of a chain and gives drips with its own cursor and wallet
+type pipeline struct {
+	config  chainConfig
+	network *utils.Network
+	rpc     *web3.Pool
+	mysql   *sqlx.DB
+	repo    repository.Metis
+	syncer  *services.DataSync
+	faucet  *services.Faucet
+	tokens  *services.Tokens
+	// webhooks is nil if webhooks are disabled
+	webhooks *services.Webhooks
+	// publisher is nil if the outbox is disabled
+	publisher *services.Publisher
+
+	// the leaders are nil if leader election is disabled
+	syncLeader   *services.Leader
+	faucetLeader *services.Leader
+	outboxLeader *services.Leader
+
+	// the syncer wakes the faucet up as soon as new deposits are committed
+	newDeposits chan struct{}
+}
+
+// pipelineOptions are shared by the pipelines of the process
+type pipelineOptions struct {
+	// sink is nil if the outbox is disabled
+	sink services.Sink
+	// instance identifies the replica, leaseTTL is 0 if leader election is disabled
+	instance string
+	leaseTTL time.Duration
+	// backfill assigns the rows without a chain id to the chain, it's only set if a single chain is configured
+	backfill bool
+}
+
+func newPipeline(ctx context.Context, config chainConfig, mysql *sqlx.DB, opts pipelineOptions) (*pipeline, error) {
+	rpc, err := web3.Dial(ctx, config.Rpc, config.RpcSend)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to rpc: %s", err)
+	}
+	rpc.Hedge, rpc.MaxLag, rpc.MaxStale = time.Duration(config.RpcHedge), config.RpcMaxLag, time.Duration(config.RpcMaxStale)
+
+	chainId := rpc.ExpectedChainID()
+	if config.ChainId != 0 && config.ChainId != chainId.Uint64() {
+		rpc.Close()
+		return nil, fmt.Errorf("rpc chain id %s does not match %d", chainId, config.ChainId)
+	}
+	config.ChainId = chainId.Uint64()
+
+	network, err := config.network()
+	if err != nil {
+		rpc.Close()
+		return nil, err
+	}
+
+	bridge, err := metisl2.NewL2StandardBridge(common.HexToAddress(network.BridgeAddress), rpc)
+	if err != nil {
+		rpc.Close()
+		return nil, fmt.Errorf("unable to create bridge instance: %s", err)
+	}
+
+	p := &pipeline{
+		config:      config,
+		network:     network,
+		rpc:         rpc,
+		mysql:       mysql,
+		newDeposits: make(chan struct{}, 1),
+	}
+
+	repo := repository.NewMetis(mysql, config.ChainId)
+	p.repo = repo
+	if err := assignLegacyRows(ctx, repo, opts.backfill); err != nil {
+		rpc.Close()
+		return nil, err
+	}
+	// the webhooks and the sink are the consumers of one outbox
+	if opts.sink != nil || config.WebhookURL != "" {
+		repo = repo.WithOutbox(config.WebhookURL != "", opts.sink != nil)
+	}
+
+	// the syncer, the faucet and the outbox write with the fencing tokens of their roles
+	syncRepo, faucetRepo, outboxRepo := repo, repo, repo
+	if opts.leaseTTL > 0 {
+		p.syncLeader = newLeader(repo, "sync", opts)
+		p.outboxLeader = newLeader(repo, "outbox", opts)
+		syncRepo = repo.WithFence(p.syncLeader.Fence)
+		outboxRepo = repo.WithFence(p.outboxLeader.Fence)
+	}
+	// faucet workers claim deposits concurrently, so only a single faucet is elected.
+	// A dry run is elected apart, it runs beside the faucet.
+	if opts.leaseTTL > 0 && !config.FaucetWorker {
+		var role = "faucet"
+		if config.DryRun {
+			role = "shadow"
+		}
+		p.faucetLeader = newLeader(repo, role, opts)
+		faucetRepo = repo.WithFence(p.faucetLeader.Fence)
+	}
+
+	if opts.sink != nil {
+		p.publisher = &services.Publisher{Repositroy: outboxRepo, Sink: opts.sink}
+	}
+	if config.WebhookURL != "" {
+		p.webhooks = &services.Webhooks{
+			Repositroy:  outboxRepo,
+			URL:         config.WebhookURL,
+			Secret:      config.WebhookSecret,
+			MaxAttempts: config.WebhookMaxAttempts,
+			Backoff:     time.Second * 10,
+			MaxBackoff:  time.Hour,
+		}
+	}
+
+	p.tokens = services.NewTokens(rpc, repo)
+	p.syncer = &services.DataSync{
+		Network:    network,
+		Web3Client: rpc,
+		Repositroy: syncRepo,
+		Bridge:     bridge,
+		RangeSync:  config.RangeSync,
+		DripHeight: config.DripHeight,
+
+		MaxRangeSync:   config.MaxRangeSync,
+		CatchUpRange:   config.CatchUpRange,
+		CatchUpWorkers: config.CatchUpWorkers,
+	}
+
+	// a dry run builds a faucet which records the drips in the shadow drips instead of broadcasting them
+	if config.OpenFaucet || config.DryRun {
+		var wallets []*services.Wallet
+		for _, keyPath := range config.Keys {
+			prvkey, wallet, err := utils.ReadPrvkey(keyPath)
+			if err != nil {
+				rpc.Close()
+				return nil, fmt.Errorf("unable to read pricate key: %s", err)
+			}
+			logrus.Infof("Current wallet address of %s is %s", network.Name, wallet)
+			wallets = append(wallets, services.NewWallet(prvkey))
+		}
+
+		var treasury *services.Wallet
+		if config.TreasuryKey != "" {
+			prvkey, wallet, err := utils.ReadPrvkey(config.TreasuryKey)
+			if err != nil {
+				rpc.Close()
+				return nil, fmt.Errorf("unable to read treasury key: %s", err)
+			}
+			logrus.Infof("Treasury address of %s is %s", network.Name, wallet)
+			treasury = services.NewWallet(prvkey)
+		}
+
+		p.faucet = &services.Faucet{
+			Network:      network,
+			Web3Client:   rpc,
+			Repositroy:   faucetRepo,
+			Uniswap:      utils.NewUniswapWithEndpoint(network.PriceSubgraph),
+			Tokens:       p.tokens,
+			Wallets:      wallets,
+			Eip155Signer: types.NewEIP155Signer(chainId),
+			Treasury:     treasury,
+			RefillBelow:  utils.ToWei(config.RefillBelow),
+			RefillAmount: utils.ToWei(config.RefillAmount),
+			DripHeight:   config.DripHeight,
+			DripAmount:   utils.ToWei(config.DripAmount),
+			MinUSD:       config.MinUSD,
+			CheckWorkers: config.CheckWorkers,
+			FromLimit:    config.FromLimit,
+			FromWindow:   time.Duration(config.FromWindow),
+			Budget: services.Budget{
+				MaxDripsPerHour: config.MaxDripsPerHour,
+				MaxMetisPerDay:  config.MaxMetisPerDay,
+			},
+			CheckAtDepositHeight: config.CheckAtDeposit,
+			DryRun:               config.DryRun,
+			DryRunFrom:           config.DryRunFrom,
+			LowBalance:           config.LowBalance,
+		}
+		p.syncer.NewDeposits = p.newDeposits
+	}
+	return p, nil
+}
+
+func (p *pipeline) api() *api.Chain {
+	chain := &api.Chain{
+		Deposits: &services.Deposits{Repositroy: p.repo, Tokens: p.tokens},
+		Faucet:   p.faucet,
+		Readiness: api.Readiness{
+			ChainId:           p.network.ChainId,
+			Web3Client:        p.rpc,
+			DB:                p.mysql,
+			Syncer:            p.syncer,
+			MaxSyncDelay:      time.Duration(p.config.ReadySyncDelay),
+			MaxFaucetFailures: p.config.ReadyFaucetFailures,
+		},
+	}
+	if p.syncLeader != nil {
+		chain.Readiness.SyncLeader = p.syncLeader
+	}
+	return chain
+}
+
+// drain runs after the loops have returned, it broadcasts the drips committed but not broadcast yet.
+// The sync cursor needs no flush, it's committed together with the deposits of each range.
+func (p *pipeline) drain(ctx context.Context) error {
+	if p.faucet == nil {
+		return nil
+	}
+	if count := p.faucet.Inflight(); count > 0 {
+		logrus.Infof("Draining %d drips of %s", count, p.network.Name)
+	}
+	return p.faucet.Drain(ctx)
+}
+
+func (p *pipeline) close() {
+	p.rpc.Close()
+}
+
+func newLeader(repo repository.Metis, role string, opts pipelineOptions) *services.Leader {
+	return &services.Leader{
+		Repositroy: repo,
+		Role:       role,
+		Holder:     opts.instance,
+		TTL:        opts.leaseTTL,
+		Fence:      repository.NewFence(role, opts.instance),
+	}
+}
+
+// lead runs the role in the group, only while holding its lease if leader election is enabled
+func lead(eg *errgroup.Group, ctx context.Context, leader *services.Leader, fn func(ctx context.Context) error) {
+	eg.Go(func() error {
+		if leader == nil {
+			return fn(ctx)
+		}
+		return leader.Run(ctx, fn)
+	})
+}
+
+// run starts the loops of the pipeline in the group, they return once the context is done.
+// The syncer finishes the range in progress and the faucet stops taking new deposits.
+func (p *pipeline) run(eg *errgroup.Group, egctx context.Context) {
+	eg.Go(func() error {
+		p.rpc.Run(egctx, time.Second*15)
+		return nil
+	})
+
+	lead(eg, egctx, p.outboxLeader, p.runOutbox)
+	lead(eg, egctx, p.syncLeader, p.runSyncer)
+	if p.faucet != nil {
+		lead(eg, egctx, p.faucetLeader, p.runFaucet)
+	}
+}
+
+// runOutbox delivers the webhooks and publishes the outbox events
+func (p *pipeline) runOutbox(ctx context.Context) error {
+	var eg errgroup.Group
+	if p.publisher != nil {
+		eg.Go(func() error {
+			p.publisher.Run(ctx, time.Second*5)
+			return nil
+		})
+	}
+	if p.webhooks != nil {
+		eg.Go(func() error {
+			p.webhooks.Run(ctx, time.Second*5)
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+// runSyncer starts from the stored cursor, which is read again whenever the role is taken over
+func (p *pipeline) runSyncer(ctx context.Context) error {
+	if err := p.syncer.Prefight(ctx); err != nil {
+		return err
+	}
+	logrus.Infof("fetching new events of %s", p.network.Name)
+	if p.config.Subscribe {
+		return p.syncer.Subscribe(ctx)
+	}
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			p.syncer.Run(ctx)
+			timer.Reset(time.Minute / 2)
+		}
+	}
+}
+
+// runFaucet starts from the pending nonce, which is read again whenever the role is taken over
+func (p *pipeline) runFaucet(ctx context.Context) error {
+	if err := p.faucet.Initial(ctx); err != nil {
+		return err
+	}
+	// the interval is a fallback of the new deposits notification
+	p.faucet.Run(ctx, p.newDeposits, time.Minute)
+	return nil
+}
+
+// assignLegacyRows backfills the chain id of the rows written by a faucet of a single chain,
+// the chain they belong to is unknown if several chains are configured
+func assignLegacyRows(ctx context.Context, repo repository.Metis, backfill bool) error {
+	if backfill {
+		count, err := repo.BackfillChainId(ctx)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logrus.Infof("Assigned %d rows without a chain id to chain %d", count, repo.ChainId())
+		}
+		return nil
+	}
+
+	count, err := repo.CountNoChainRows(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%d rows have no chain id, start the faucet with only the chain they belong to once", count)
+	}
+	return nil
+}